@@ -0,0 +1,357 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sonacy/go-whistle-lite/importer"
+	"github.com/sonacy/go-whistle-lite/mitm"
+	"github.com/sonacy/go-whistle-lite/rules"
+	"github.com/sonacy/go-whistle-lite/truststore"
+)
+
+/* ---------- sub-commands: gw-lite <cmd> [args] ---------- */
+
+var commands = map[string]func(args []string) int{
+	"check":   runCheck,
+	"explain": runExplain,
+	"convert": runConvert,
+	"import":  runImport,
+	"ca":      runCA,
+}
+
+// runCommand 若 os.Args[1] 是子命令则执行并返回 true
+func runCommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		return false
+	}
+	os.Exit(cmd(os.Args[2:]))
+	return true
+}
+
+/* ---------- check: 校验规则文件，供 CI 使用 ---------- */
+
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gw-lite check [rules.txt|rules.yaml ...]")
+	}
+	_ = fs.Parse(args)
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{rules.File()}
+	}
+
+	code := 0
+	for _, f := range files {
+		n, err := rules.Check(f)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: ok, %d rule(s)\n", f, n)
+	}
+	return code
+}
+
+/* ---------- explain: 说明某个 URL 会命中哪条规则 ---------- */
+
+// headerFlags 收集重复的 -H "Key: Value"
+type headerFlags http.Header
+
+func (h headerFlags) String() string { return "" }
+func (h headerFlags) Set(kv string) error {
+	k, v, ok := strings.Cut(kv, ":")
+	if !ok {
+		return fmt.Errorf("want \"Key: Value\", got %q", kv)
+	}
+	http.Header(h).Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	return nil
+}
+
+func runExplain(args []string) int {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	file := fs.String("rules", rules.File(), "rule file")
+	method := fs.String("X", http.MethodGet, "request method")
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	hdr := headerFlags{}
+	fs.Var(hdr, "H", `request header "Key: Value" (repeatable)`)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gw-lite explain [-rules rules.txt] [-X METHOD] [-H 'K: V'] URL")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	u, err := url.Parse(fs.Arg(0))
+	if err != nil || !u.IsAbs() {
+		fmt.Fprintf(os.Stderr, "explain: %q is not an absolute URL\n", fs.Arg(0))
+		return 2
+	}
+	t, err := rules.ExplainFile(*file, u, strings.ToUpper(*method), http.Header(hdr))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(t)
+		return 0
+	}
+	fmt.Print(t)
+	return 0
+}
+
+/* ---------- convert: DSL ⇄ YAML / JSON ---------- */
+
+func runConvert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	to := fs.String("to", "", "output format: txt, yaml or json (default: from OUT extension)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gw-lite convert [-to txt|yaml|json] IN [OUT]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+
+	in, out := fs.Arg(0), fs.Arg(1)
+	format := *to
+	if format == "" && out != "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(out)), ".")
+	}
+	if format == "" {
+		fmt.Fprintln(os.Stderr, "convert: need -to or an OUT file with extension")
+		return 2
+	}
+
+	b, err := rules.Convert(in, format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if out == "" {
+		os.Stdout.Write(b)
+		return 0
+	}
+	if err := os.WriteFile(out, b, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+/* ---------- import: whistle / Charles / Proxyman → rules.txt ---------- */
+
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	from := fs.String("from", "", "source: whistle, charles or proxyman (default: by extension, .xml → charles, .json → proxyman)")
+	assets := fs.String("assets", "", "directory to save inline bodies into")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gw-lite import [-from whistle|charles|proxyman] [-assets DIR] IN [OUT]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+
+	in, out := fs.Arg(0), fs.Arg(1)
+	src := *from
+	if src == "" {
+		switch strings.ToLower(filepath.Ext(in)) {
+		case ".xml":
+			src = "charles"
+		case ".json":
+			src = "proxyman"
+		default:
+			src = "whistle"
+		}
+	}
+
+	data, err := os.ReadFile(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	res, err := importer.Import(src, data, importer.Options{AssetDir: *assets})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, res.Summary())
+
+	if out == "" {
+		fmt.Print(res.Text())
+		return 0
+	}
+	if err := os.WriteFile(out, []byte(res.Text()), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+/* ---------- ca: 查看 / 导出 / 轮换 MITM 根证书 ---------- */
+
+func runCA(args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, `usage: gw-lite ca info   [-ca-cert F [-ca-key F [-ca-key-pass P]]]
+       gw-lite ca export [-format pem|der] [-ca-cert F] [OUT]
+       gw-lite ca regenerate
+       gw-lite ca install|uninstall [-nss] [-system=false] [-root DIR] [-ca-cert F]`)
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	fs := flag.NewFlagSet("ca "+args[0], flag.ExitOnError)
+	certFile := fs.String("ca-cert", "", "CA certificate (PEM, may include the chain)")
+	keyFile := fs.String("ca-key", "", "CA private key (PKCS#1, SEC1 or PKCS#8, optionally encrypted)")
+	pass := fs.String("ca-key-pass", os.Getenv("GW_CA_KEY_PASS"), "password of an encrypted CA key")
+	format := fs.String("format", "pem", "export format: pem or der")
+	system := fs.Bool("system", true, "install: update the system trust store")
+	nss := fs.Bool("nss", false, "install: also update NSS databases (~/.pki/nssdb, Firefox profiles)")
+	root := fs.String("root", "/", "install: filesystem root (a temp dir for testing; skips the update tools)")
+	_ = fs.Parse(args[1:])
+
+	// 除 regenerate 外都只读取已有 CA，绝不生成；sudo 下默认路径取调用者的 home
+	cert, key := *certFile, *keyFile
+	if cert == "" && key == "" {
+		cert, key = mitm.DefaultCAPaths()
+	}
+	if cert == "" {
+		fmt.Fprintln(os.Stderr, "ca: -ca-key needs -ca-cert")
+		return 2
+	}
+
+	switch args[0] {
+	case "info":
+		var (
+			ca  *mitm.CA
+			err error
+		)
+		if _, kErr := os.Stat(key); key != "" && kErr == nil {
+			ca, err = mitm.LoadCA(cert, key, *pass)
+		} else {
+			ca, err = mitm.LoadCACert(cert)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		printCA(ca)
+	case "export":
+		ca, err := mitm.LoadCACert(cert)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		var b []byte
+		switch *format {
+		case "pem":
+			b = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+		case "der":
+			b = ca.Root.Raw
+		default:
+			fmt.Fprintf(os.Stderr, "unknown format %q (want pem or der)\n", *format)
+			return 2
+		}
+		if fs.NArg() == 0 {
+			os.Stdout.Write(b)
+			return 0
+		}
+		if err := os.WriteFile(fs.Arg(0), b, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	case "install", "uninstall":
+		ca, err := mitm.LoadCACert(cert) // 只需要证书，不读私钥
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		o := truststore.Options{Root: *root, System: *system, NSS: *nss}
+		nick := ca.Root.Subject.CommonName
+		var steps []string
+		if args[0] == "install" {
+			steps, err = truststore.Install(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}), nick, o)
+		} else {
+			steps, err = truststore.Uninstall(nick, o)
+		}
+		for _, s := range steps {
+			fmt.Println(s)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	case "regenerate":
+		ca, err := mitm.RegenerateCA()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		printCA(ca)
+	default:
+		usage()
+		return 2
+	}
+	return 0
+}
+
+func printCA(ca *mitm.CA) {
+	c := ca.Cert
+	kind := "root (self-signed)"
+	if ca.IsIntermediate() {
+		kind = fmt.Sprintf("intermediate, %d chain cert(s) sent with leaves", len(ca.Chain))
+	}
+	fmt.Printf("file:        %s\n", ca.CertFile)
+	if ca.Key != nil {
+		fmt.Printf("key:         %s (%s)\n", ca.KeyFile, keyType(ca.Key))
+	} else {
+		fmt.Printf("key:         not loaded\n")
+	}
+	fmt.Printf("type:        %s\n", kind)
+	fmt.Printf("subject:     %s\n", c.Subject)
+	fmt.Printf("issuer:      %s\n", c.Issuer)
+	fmt.Printf("serial:      %X\n", c.SerialNumber)
+	fmt.Printf("valid:       %s → %s\n", c.NotBefore.Format(time.DateOnly), c.NotAfter.Format(time.DateOnly))
+	fmt.Printf("sha256:      %s\n", mitm.Fingerprint(c))
+}
+
+func keyType(k any) string {
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		return fmt.Sprintf("RSA-%d", k.N.BitLen())
+	case *ecdsa.PrivateKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case ed25519.PrivateKey:
+		return "Ed25519"
+	}
+	return fmt.Sprintf("%T", k)
+}
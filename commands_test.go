@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCACert 只写出 CA 证书，不写私钥
+func testCACert(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gw-lite test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestCANeverGenerates(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SUDO_USER", "")
+	root := t.TempDir()
+	for _, args := range [][]string{
+		{"info"},
+		{"export", filepath.Join(t.TempDir(), "out.pem")},
+		{"install", "-root", root},
+		{"uninstall", "-root", root},
+	} {
+		if code := runCA(args); code == 0 {
+			t.Errorf("ca %v succeeded without a CA", args)
+		}
+		if _, err := os.Stat(filepath.Join(home, "go-whistle-lite")); !os.IsNotExist(err) {
+			t.Fatalf("ca %v created %s/go-whistle-lite", args, home)
+		}
+	}
+}
+
+func TestCAInstallCertOnly(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cert := testCACert(t)
+	root := t.TempDir()
+	dir := filepath.Join(root, "usr/local/share/ca-certificates")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	installed := filepath.Join(dir, "go-whistle-lite.crt")
+
+	if code := runCA([]string{"install", "-root", root, "-ca-cert", cert}); code != 0 {
+		t.Fatalf("install exit %d", code)
+	}
+	want, _ := os.ReadFile(cert)
+	if got, err := os.ReadFile(installed); err != nil || string(got) != string(want) {
+		t.Fatalf("installed certificate = %q, %v", got, err)
+	}
+	if code := runCA([]string{"uninstall", "-root", root, "-ca-cert", cert}); code != 0 {
+		t.Fatalf("uninstall exit %d", code)
+	}
+	if _, err := os.Stat(installed); !os.IsNotExist(err) {
+		t.Errorf("certificate still installed: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+// Package fault 实现 fault:// 故障注入：RST、挂起、截断 body、畸形 chunked。
+// HTTP/1.x 直接操作底层连接，HTTP/2 通过 RST_STREAM 中断单个流。
+package fault
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+// maxBody 截断 / 坏 chunk 需要完整 body，超出部分直接丢弃
+const maxBody = 32 << 20
+
+// Roll 解析参数并按百分比掷骰；ok=false 表示本次不注入
+func Roll(p string) (rules.Fault, bool) {
+	f, err := rules.ParseFault(p)
+	if err != nil {
+		logx.D("[fault  ] %v", err)
+		return f, false
+	}
+	return f, rules.Chance(f.Percent)
+}
+
+/* ---------- HTTP/1.x：原始连接 ---------- */
+
+// Conn 在 HTTP/1.x 连接上执行故障；返回后连接已不可复用，调用方应结束循环。
+// resp 仅 truncate / badchunk 需要。
+func Conn(c net.Conn, f rules.Fault, resp *http.Response) {
+	logx.D("[fault  ] %s on %s", f.Kind, c.RemoteAddr())
+	switch f.Kind {
+	case "reset":
+		reset(c)
+	case "hang":
+		io.Copy(io.Discard, c) // 只读不写，直到客户端放弃
+		c.Close()
+	case "truncate", "badchunk":
+		defer c.Close()
+		if resp == nil {
+			return
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+		bw := bufio.NewWriter(c)
+		writeHead(bw, resp, f, len(body))
+		if f.Kind == "truncate" {
+			bw.Write(body[:min(f.N, len(body))])
+		} else {
+			half := body[:len(body)/2]
+			fmt.Fprintf(bw, "%x\r\n%s\r\n", len(half), half)
+			bw.WriteString("zz\r\n") // 非法的 chunk size
+			bw.Write(body[len(half):])
+		}
+		bw.Flush()
+	}
+}
+
+// writeHead 写出状态行与响应头：truncate 声明完整长度，badchunk 声明 chunked
+func writeHead(w io.Writer, resp *http.Response, f rules.Fault, n int) {
+	h := resp.Header.Clone()
+	h.Del("Transfer-Encoding")
+	h.Del("Content-Length")
+	if f.Kind == "truncate" {
+		h.Set("Content-Length", strconv.Itoa(n))
+	} else {
+		h.Set("Transfer-Encoding", "chunked")
+	}
+	h.Set("Connection", "close")
+	fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+	h.Write(w)
+	io.WriteString(w, "\r\n")
+}
+
+// reset 以 SO_LINGER=0 关闭底层 TCP 连接，对端收到 RST
+func reset(c net.Conn) {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	if tc, ok := c.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	c.Close()
+}
+
+/* ---------- http.Handler 路径：明文代理 (H1 hijack) 与 MITM H2 ---------- */
+
+// Serve 在 handler 中执行故障：HTTP/1.x 接管连接后交给 Conn；
+// HTTP/2 没有 chunked，badchunk 与 truncate 一样在发送部分 body 后重置流
+func Serve(w http.ResponseWriter, r *http.Request, f rules.Fault, resp *http.Response) {
+	if r.ProtoMajor == 2 {
+		serveH2(w, r, f, resp)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	c, _, err := hj.Hijack()
+	if err != nil {
+		logx.D("[fault  ] hijack: %v", err)
+		return
+	}
+	if resp != nil {
+		for k, v := range w.Header() { // 带上已设置的 X-Gw-Rule 等头
+			resp.Header[k] = v
+		}
+	}
+	Conn(c, f, resp)
+}
+
+func serveH2(w http.ResponseWriter, r *http.Request, f rules.Fault, resp *http.Response) {
+	logx.D("[fault  ] %s on h2 stream %s", f.Kind, r.URL)
+	switch f.Kind {
+	case "hang":
+		<-r.Context().Done()
+		return
+	case "truncate", "badchunk":
+		if resp == nil {
+			break
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+		n := len(body) / 2
+		if f.Kind == "truncate" {
+			n = min(f.N, len(body))
+		}
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(resp.StatusCode)
+		w.Write(body[:n])
+		if fl, ok := w.(http.Flusher); ok {
+			fl.Flush()
+		}
+	}
+	panic(http.ErrAbortHandler) // http2.Server 以 RST_STREAM 结束该流
+}
@@ -0,0 +1,125 @@
+// Package grpcx 解析 gRPC 的长度前缀帧：调试日志中逐条展示消息与状态，
+// 并生成 grpc:// 的模拟响应。消息按 .protoset 描述符解码，没有描述符时按 wire 格式粗略展示。
+package grpcx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+// IsGRPC 判断 Content-Type 是否为 gRPC，与规则的 grpc: 过滤器一致
+func IsGRPC(h http.Header) bool { return rules.IsGRPCContentType(h.Get("Content-Type")) }
+
+// appendFrame 追加一条未压缩的消息：1 字节压缩标志 + 4 字节大端长度 + 数据
+func appendFrame(b, msg []byte) []byte {
+	b = append(b, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// encodeMessage 按 gRPC 规范对 grpc-message 做百分号编码
+func encodeMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+/* ---------- 没有描述符时：类似 protoc --decode_raw ---------- */
+
+// maxRaw 限制单条消息在日志里的长度
+const maxRaw = 1024
+
+// raw 按 wire 格式展示：{1:"abc" 2:42 3:{1:1}}；不是合法 protobuf 时给出十六进制
+func raw(b []byte) string {
+	s, ok := rawFields(b, 0)
+	if !ok {
+		s = fmt.Sprintf("0x%x", b)
+	}
+	if len(s) > maxRaw {
+		s = s[:maxRaw] + "…"
+	}
+	return s
+}
+
+func rawFields(b []byte, depth int) (string, bool) {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", false
+		}
+		b = b[n:]
+		if sb.Len() > 1 {
+			sb.WriteByte(' ')
+		}
+		fmt.Fprintf(&sb, "%d:", num)
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return "", false
+			}
+			fmt.Fprint(&sb, v)
+			b = b[n:]
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(b)
+			if n < 0 {
+				return "", false
+			}
+			fmt.Fprintf(&sb, "0x%08x", v)
+			b = b[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return "", false
+			}
+			fmt.Fprintf(&sb, "0x%016x", v)
+			b = b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return "", false
+			}
+			b = b[n:]
+			// 可打印文本按字符串显示，否则尝试当作嵌套消息，再不行就是字节
+			if printable(v) {
+				fmt.Fprintf(&sb, "%q", v)
+			} else if s, ok := rawFields(v, depth+1); ok && depth < 16 {
+				sb.WriteString(s)
+			} else {
+				fmt.Fprintf(&sb, "0x%x", v)
+			}
+		default: // group 已废弃，不展开
+			return "", false
+		}
+	}
+	sb.WriteByte('}')
+	return sb.String(), true
+}
+
+func printable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,207 @@
+package grpcx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type seen struct {
+	n          int
+	compressed bool
+	size       int
+	data       []byte
+}
+
+func tapAll(t *testing.T, body []byte, chunked bool) (got []seen, eof int) {
+	t.Helper()
+	var r io.Reader = bytes.NewReader(body)
+	if chunked {
+		r = iotest.OneByteReader(r)
+	}
+	tp := &tap{
+		rc: io.NopCloser(r),
+		msg: func(n int, compressed bool, size int, data []byte) {
+			got = append(got, seen{n, compressed, size, bytes.Clone(data)})
+		},
+		eof: func() { eof++ },
+	}
+	out, err := io.ReadAll(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, body) {
+		t.Fatal("tap changed the body")
+	}
+	return got, eof
+}
+
+func TestTapSplitsFrames(t *testing.T) {
+	body := appendFrame(nil, []byte("one"))
+	body = append(body, 1, 0, 0, 0, 2, 'z', 'z') // 压缩标志
+	body = appendFrame(body, nil)
+	for _, chunked := range []bool{false, true} {
+		got, eof := tapAll(t, body, chunked)
+		want := []seen{{1, false, 3, []byte("one")}, {2, true, 2, []byte("zz")}, {3, false, 0, []byte{}}}
+		if len(got) != len(want) || eof != 1 {
+			t.Fatalf("chunked=%v: got %d frames, %d eof; want %d, 1", chunked, len(got), eof, len(want))
+		}
+		for i := range want {
+			g, w := got[i], want[i]
+			if g.n != w.n || g.compressed != w.compressed || g.size != w.size || !bytes.Equal(g.data, w.data) {
+				t.Errorf("chunked=%v frame %d = %+v, want %+v", chunked, i, g, w)
+			}
+		}
+	}
+}
+
+func TestTapSkipsLargeFrames(t *testing.T) {
+	big := make([]byte, maxShow+1)
+	body := appendFrame(appendFrame(nil, big), []byte("after"))
+	got, _ := tapAll(t, body, false)
+	if len(got) != 2 {
+		t.Fatalf("got %d frames, want 2", len(got))
+	}
+	if got[0].size != maxShow+1 || got[0].data != nil {
+		t.Errorf("large frame = size %d, data %d bytes; want size only", got[0].size, len(got[0].data))
+	}
+	if string(got[1].data) != "after" {
+		t.Errorf("frame after the large one = %q", got[1].data)
+	}
+}
+
+func TestRaw(t *testing.T) {
+	nested := protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1)
+	msg := protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), "abc")
+	msg = protowire.AppendVarint(protowire.AppendTag(msg, 2, protowire.VarintType), 42)
+	msg = protowire.AppendBytes(protowire.AppendTag(msg, 3, protowire.BytesType), nested)
+	msg = protowire.AppendFixed32(protowire.AppendTag(msg, 4, protowire.Fixed32Type), 7)
+	cases := []struct {
+		in   []byte
+		want string
+	}{
+		{msg, `{1:"abc" 2:42 3:{1:1} 4:0x00000007}`},
+		{nil, "{}"},
+		{[]byte{0xff}, "0xff"},
+	}
+	for _, c := range cases {
+		if got := raw(c.in); got != c.want {
+			t.Errorf("raw(%x) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	if got := encodeMessage("50% ünïcode\n"); got != "50%25 %C3%BCn%C3%AFcode%0A" {
+		t.Errorf("encodeMessage = %q", got)
+	}
+}
+
+// demoProtoset 写出 demo.Greeter/SayHello(HelloRequest{name}) → HelloReply{message, count}
+func demoProtoset(t *testing.T) string {
+	t.Helper()
+	s := proto.String
+	opt := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	field := func(name string, n int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{Name: s(name), JsonName: s(name), Number: proto.Int32(n), Label: opt, Type: typ.Enum()}
+	}
+	fd := &descriptorpb.FileDescriptorProto{
+		Name: s("demo.proto"), Package: s("demo"), Syntax: s("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: s("HelloRequest"), Field: []*descriptorpb.FieldDescriptorProto{field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING)}},
+			{Name: s("HelloReply"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("message", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{Name: s("Greeter"), Method: []*descriptorpb.MethodDescriptorProto{
+			{Name: s("SayHello"), InputType: s(".demo.HelloRequest"), OutputType: s(".demo.HelloReply")},
+		}}},
+	}
+	b, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fd}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "demo.protoset")
+	if err := os.WriteFile(p, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// fields 解出顶层的 string / varint 字段（字段顺序不固定）
+func fields(t *testing.T, b []byte) map[protowire.Number]any {
+	t.Helper()
+	m := map[protowire.Number]any{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		b = b[n:]
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			m[num], b = v, b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			m[num], b = v, b[n:]
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+	}
+	return m
+}
+
+func mockCall(t *testing.T, path, param string) (*http.Response, []byte) {
+	t.Helper()
+	r, _ := http.NewRequest("POST", "https://a.com"+path, nil)
+	resp := Response(r, param)
+	body, _ := io.ReadAll(resp.Body)
+	return resp, body
+}
+
+func TestResponse(t *testing.T) {
+	ps := demoProtoset(t)
+
+	resp, body := mockCall(t, "/demo.Greeter/SayHello", "status=NOT_FOUND,message=no%20such%20user")
+	if resp.Header.Get("Grpc-Status") != "5" || resp.Header.Get("Grpc-Message") != "no such user" || len(body) != 0 {
+		t.Errorf("trailers-only: header %v, body %x", resp.Header, body)
+	}
+
+	resp, body = mockCall(t, "/demo.Greeter/SayHello", `protoset=@`+ps+`,json=[{"message":"a"},{"message":"b","count":2}]`)
+	if resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("trailer = %v, want grpc-status 0", resp.Trailer)
+	}
+	var msgs []map[protowire.Number]any
+	for len(body) >= 5 {
+		n := int(binary.BigEndian.Uint32(body[1:5]))
+		msgs = append(msgs, fields(t, body[5:5+n]))
+		body = body[5+n:]
+	}
+	want := []map[protowire.Number]any{{1: "a"}, {1: "b", 2: uint64(2)}}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("messages = %v, want %v", msgs, want)
+	}
+
+	for _, param := range []string{
+		`protoset=@` + ps + `,json={"nope":1}`,    // 字段不存在
+		`json={"message":"a"}`,                    // 没有描述符
+		`protoset=@` + ps + `,json=@missing.json`, // 文件不存在
+	} {
+		resp, _ := mockCall(t, "/demo.Greeter/SayHello", param)
+		if resp.Header.Get("Grpc-Status") != "13" {
+			t.Errorf("%s: grpc-status %q, want 13 (INTERNAL)", param, resp.Header.Get("Grpc-Status"))
+		}
+	}
+	if resp, _ := mockCall(t, "/demo.Greeter/Missing", `protoset=@`+ps+`,json={}`); resp.Header.Get("Grpc-Status") != "13" {
+		t.Errorf("unknown method: header %v", resp.Header)
+	}
+}
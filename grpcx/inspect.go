@@ -0,0 +1,173 @@
+package grpcx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ----------------------------------------------------
+ *  GW_DEBUG=1 时逐条记录 gRPC 消息（边透传边切帧，不缓冲整条流），
+ *  响应结束后记录 grpc-status / grpc-message
+ * --------------------------------------------------*/
+
+// maxShow 超过该长度的消息只记录长度
+const maxShow = 4 << 20
+
+// WatchRequest 记录发往上游的消息
+func WatchRequest(r *http.Request) {
+	if !logx.Debugging() || !IsGRPC(r.Header) || r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+	path, enc := r.URL.Path, r.Header.Get("Grpc-Encoding")
+	r.Body = &tap{rc: r.Body, msg: func(n int, compressed bool, size int, data []byte) {
+		logMsg("→", path, n, compressed, enc, size, data, false)
+	}}
+}
+
+// WatchResponse 记录上游返回的消息与状态（trailers-only 响应的状态在 header 里）
+func WatchResponse(resp *http.Response) {
+	if !logx.Debugging() || !IsGRPC(resp.Header) || resp.Request == nil {
+		return
+	}
+	path, enc := resp.Request.URL.Path, resp.Header.Get("Grpc-Encoding")
+	if resp.Header.Get("Grpc-Status") != "" {
+		logStatus(path, resp.Header)
+		return
+	}
+	resp.Body = &tap{
+		rc: resp.Body,
+		msg: func(n int, compressed bool, size int, data []byte) {
+			logMsg("←", path, n, compressed, enc, size, data, true)
+		},
+		eof: func() { logStatus(path, resp.Trailer) }, // body 读完后 Trailer 才有值
+	}
+}
+
+func logMsg(dir, path string, n int, compressed bool, enc string, size int, data []byte, output bool) {
+	note := ""
+	if compressed {
+		note = " " + enc
+		if data != nil && enc == "gzip" {
+			b, err := gunzip(data)
+			if err != nil {
+				logx.D("[grpc   ] %s %s #%d %dB gzip: %v", dir, path, n, size, err)
+				return
+			}
+			data = b
+		} else {
+			data = nil
+		}
+	}
+	if data == nil {
+		logx.D("[grpc   ] %s %s #%d %dB%s (not shown)", dir, path, n, size, note)
+		return
+	}
+	logx.D("[grpc   ] %s %s #%d %dB%s %s", dir, path, n, size, note, render(path, data, output))
+}
+
+// render 有描述符时输出 JSON，否则按 wire 格式展示
+func render(path string, data []byte, output bool) string {
+	if len(protosets) > 0 {
+		if md, err := findMethod(path, protosets); err == nil {
+			typ := md.Input()
+			if output {
+				typ = md.Output()
+			}
+			msg := dynamicpb.NewMessage(typ)
+			if err := proto.Unmarshal(data, msg); err == nil {
+				if b, err := protojson.Marshal(msg); err == nil {
+					return string(b)
+				}
+			}
+		}
+	}
+	return raw(data)
+}
+
+func logStatus(path string, h http.Header) {
+	s := h.Get("Grpc-Status")
+	if s == "" {
+		logx.D("[grpc   ] ← %s no grpc-status", path)
+		return
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n < len(rules.GRPCCodes) {
+		s += " " + rules.GRPCCodes[n]
+	}
+	msg, err := url.PathUnescape(h.Get("Grpc-Message"))
+	if err != nil {
+		msg = h.Get("Grpc-Message")
+	}
+	logx.D("[grpc   ] ← %s status %s %q", path, s, msg)
+}
+
+func gunzip(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.LimitReader(zr, maxShow))
+}
+
+/* ---------- tap：透传 body，同时按长度前缀切出消息 ---------- */
+
+type tap struct {
+	rc   io.ReadCloser
+	buf  []byte
+	skip int // 过大的消息剩余待跳过的字节
+	n    int
+	msg  func(n int, compressed bool, size int, data []byte) // data 为 nil 表示未保留内容
+	eof  func()
+}
+
+func (t *tap) Read(p []byte) (int, error) {
+	n, err := t.rc.Read(p)
+	t.feed(p[:n])
+	if err == io.EOF && t.eof != nil {
+		t.eof()
+		t.eof = nil
+	}
+	return n, err
+}
+
+func (t *tap) Close() error { return t.rc.Close() }
+
+func (t *tap) feed(b []byte) {
+	if t.skip > 0 {
+		k := min(t.skip, len(b))
+		t.skip -= k
+		b = b[k:]
+	}
+	t.buf = append(t.buf, b...)
+	for len(t.buf) >= 5 {
+		compressed := t.buf[0]&1 == 1
+		size := int(binary.BigEndian.Uint32(t.buf[1:5]))
+		if size > maxShow {
+			t.n++
+			t.msg(t.n, compressed, size, nil)
+			if rest := len(t.buf) - 5; rest < size {
+				t.skip, t.buf = size-rest, t.buf[:0]
+				return
+			}
+			t.buf = append(t.buf[:0], t.buf[5+size:]...)
+			continue
+		}
+		if len(t.buf) < 5+size {
+			return
+		}
+		t.n++
+		t.msg(t.n, compressed, size, t.buf[5:5+size])
+		t.buf = append(t.buf[:0], t.buf[5+size:]...)
+	}
+}
@@ -0,0 +1,114 @@
+package grpcx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ---------- grpc://：直接返回状态，或把 JSON 按方法的响应类型编码后返回 ---------- */
+
+// Response 生成 grpc:// 的模拟响应；JSON / 描述符有误时返回 INTERNAL 并说明原因
+func Response(r *http.Request, p string) *http.Response {
+	m, err := rules.ParseGRPC(p)
+	if err != nil {
+		return trailersOnly(r, 13, "grpc:// "+err.Error())
+	}
+	if m.JSON == "" {
+		return trailersOnly(r, m.Code, m.Message)
+	}
+	body, err := encode(r.URL.Path, m)
+	if err != nil {
+		logx.D("[grpc   ] %s: %v", r.URL.Path, err)
+		return trailersOnly(r, 13, "grpc:// "+err.Error())
+	}
+	resp := newResponse(r, body)
+	resp.Trailer = statusHeader(m.Code, m.Message)
+	return resp
+}
+
+// encode 把 JSON（顶层数组 = 多条消息）编码为方法响应类型的帧
+func encode(path string, m rules.GRPCMock) ([]byte, error) {
+	ps := protosets
+	if m.Protoset != "" {
+		ps = []string{m.Protoset}
+	}
+	if len(ps) == 0 {
+		return nil, fmt.Errorf("json= needs protoset=@file or -protoset")
+	}
+	md, err := findMethod(path, ps)
+	if err != nil {
+		return nil, err
+	}
+	src := []byte(m.JSON)
+	if f, ok := strings.CutPrefix(m.JSON, "@"); ok {
+		if src, err = os.ReadFile(f); err != nil {
+			return nil, err
+		}
+	}
+	msgs := []json.RawMessage{src}
+	if t := bytes.TrimSpace(src); len(t) > 0 && t[0] == '[' {
+		if err := json.Unmarshal(t, &msgs); err != nil {
+			return nil, err
+		}
+	}
+	var out []byte
+	for i, j := range msgs {
+		msg := dynamicpb.NewMessage(md.Output())
+		if err := protojson.Unmarshal(j, msg); err != nil {
+			return nil, fmt.Errorf("message #%d as %s: %v", i+1, md.Output().FullName(), err)
+		}
+		b, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		out = appendFrame(out, b)
+	}
+	return out, nil
+}
+
+// trailersOnly 没有消息时状态直接放在 header 里（gRPC 的 Trailers-Only 响应）
+func trailersOnly(r *http.Request, code int, msg string) *http.Response {
+	resp := newResponse(r, nil)
+	for k, v := range statusHeader(code, msg) {
+		resp.Header[k] = v
+	}
+	resp.ContentLength, resp.TransferEncoding = 0, nil
+	return resp
+}
+
+func statusHeader(code int, msg string) http.Header {
+	h := http.Header{"Grpc-Status": {strconv.Itoa(code)}}
+	if msg != "" {
+		h.Set("Grpc-Message", encodeMessage(msg))
+	}
+	return h
+}
+
+// newResponse 以分块编码输出，HTTP/1 下 trailer 才能写出
+func newResponse(r *http.Request, body []byte) *http.Response {
+	return &http.Response{
+		Status:           "200 OK",
+		StatusCode:       http.StatusOK,
+		Proto:            "HTTP/1.1",
+		ProtoMajor:       1,
+		ProtoMinor:       1,
+		Header:           http.Header{"Content-Type": {"application/grpc"}},
+		ContentLength:    -1,
+		TransferEncoding: []string{"chunked"},
+		Body:             io.NopCloser(bytes.NewReader(body)),
+		Request:          r,
+	}
+}
@@ -0,0 +1,91 @@
+package grpcx
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+)
+
+/* ---------- .protoset：protoc --include_imports --descriptor_set_out=api.protoset ---------- */
+
+var protosets []string // -protoset，调试日志与未写 protoset= 的 grpc:// 使用
+
+// SetProtosets 设置全局描述符集并预先加载，文件有误时返回错误
+func SetProtosets(ps []string) error {
+	for _, p := range ps {
+		if _, err := loadSet(p); err != nil {
+			return err
+		}
+	}
+	protosets = ps
+	return nil
+}
+
+type setEntry struct {
+	mod   time.Time
+	size  int64
+	files *protoregistry.Files
+}
+
+var sets sync.Map // path → setEntry，按 mtime / size 缓存，重新生成后自动生效
+
+func loadSet(p string) (*protoregistry.Files, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := sets.Load(p); ok {
+		if e := e.(setEntry); e.mod.Equal(fi.ModTime()) && e.size == fi.Size() {
+			return e.files, nil
+		}
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &fds); err != nil {
+		return nil, fmt.Errorf("%s: not a descriptor set: %v", p, err)
+	}
+	files, err := protodesc.NewFiles(&fds)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v (generate it with --include_imports)", p, err)
+	}
+	sets.Store(p, setEntry{fi.ModTime(), fi.Size(), files})
+	logx.D("[grpc   ] loaded %d file(s) from %s", files.NumFiles(), p)
+	return files, nil
+}
+
+// findMethod 在描述符集中按 /package.Service/Method 查找方法
+func findMethod(path string, ps []string) (protoreflect.MethodDescriptor, error) {
+	svc, name, ok := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !ok || svc == "" || name == "" {
+		return nil, fmt.Errorf("%q is not /package.Service/Method", path)
+	}
+	for _, p := range ps {
+		files, err := loadSet(p)
+		if err != nil {
+			return nil, err
+		}
+		d, err := files.FindDescriptorByName(protoreflect.FullName(svc))
+		if err != nil {
+			continue
+		}
+		if sd, ok := d.(protoreflect.ServiceDescriptor); ok {
+			if md := sd.Methods().ByName(protoreflect.Name(name)); md != nil {
+				return md, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("method %s/%s not found in %s", svc, name, strings.Join(ps, ", "))
+}
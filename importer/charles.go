@@ -0,0 +1,299 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ---------- Charles: Map Remote / Map Local / Rewrite 的 XML 导出 ----------
+ *
+ * 既可以是单个工具的导出（根元素 mapRemote / mapLocal / rewrite），
+ * 也可以是完整设置导出——扫描到这三个元素即解析。
+ */
+
+type charlesLoc struct {
+	Protocol string `xml:"protocol"`
+	Host     string `xml:"host"`
+	Port     string `xml:"port"`
+	Path     string `xml:"path"`
+	Query    string `xml:"query"`
+}
+
+type charlesMapRemote struct {
+	Mappings []struct {
+		Source       charlesLoc `xml:"sourceLocation"`
+		Dest         charlesLoc `xml:"destLocation"`
+		PreserveHost bool       `xml:"preserveHostHeader"`
+		Enabled      bool       `xml:"enabled"`
+	} `xml:"mappings>mapMapping"`
+}
+
+type charlesMapLocal struct {
+	Mappings []struct {
+		Source  charlesLoc `xml:"sourceLocation"`
+		Dest    string     `xml:"dest"`
+		Enabled bool       `xml:"enabled"`
+	} `xml:"mappings>mapLocalMapping"`
+}
+
+type charlesRewrite struct {
+	Sets []struct {
+		Active    bool   `xml:"active"`
+		Name      string `xml:"name"`
+		Locations []struct {
+			Location charlesLoc `xml:"location"`
+			Enabled  bool       `xml:"enabled"`
+		} `xml:"hosts>locationPatterns>locationMatch"`
+		Rules []charlesRewriteRule `xml:"rules>rewriteRule"`
+	} `xml:"sets>rewriteSet"`
+}
+
+type charlesRewriteRule struct {
+	Active        bool   `xml:"active"`
+	RuleType      int    `xml:"ruleType"`
+	MatchHeader   string `xml:"matchHeader"`
+	MatchValue    string `xml:"matchValue"`
+	MatchRequest  bool   `xml:"matchRequest"`
+	MatchResponse bool   `xml:"matchResponse"`
+	NewHeader     string `xml:"newHeader"`
+	NewValue      string `xml:"newValue"`
+}
+
+// Charles rewriteRule.ruleType
+const (
+	chAddHeader    = 1
+	chModifyHeader = 2
+	chRemoveHeader = 3
+	chStatus       = 11
+)
+
+var charlesRuleTypes = map[int]string{
+	4: "host", 5: "path", 6: "URL", 7: "body", 8: "add query param",
+	9: "modify query param", 10: "remove query param",
+}
+
+func fromCharles(data []byte) (*Result, error) {
+	res := &Result{}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	found := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("charles: %v", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "mapRemote":
+			var v charlesMapRemote
+			if err := dec.DecodeElement(&v, &se); err != nil {
+				return nil, fmt.Errorf("charles mapRemote: %v", err)
+			}
+			res.charlesMapRemote(&v)
+		case "mapLocal":
+			var v charlesMapLocal
+			if err := dec.DecodeElement(&v, &se); err != nil {
+				return nil, fmt.Errorf("charles mapLocal: %v", err)
+			}
+			res.charlesMapLocal(&v)
+		case "rewrite":
+			var v charlesRewrite
+			if err := dec.DecodeElement(&v, &se); err != nil {
+				return nil, fmt.Errorf("charles rewrite: %v", err)
+			}
+			res.charlesRewrite(&v)
+		default:
+			continue
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("charles: no mapRemote / mapLocal / rewrite section found")
+	}
+	return res, nil
+}
+
+func (res *Result) charlesMapRemote(v *charlesMapRemote) {
+	res.comment("Charles Map Remote")
+	for i, m := range v.Mappings {
+		where := fmt.Sprintf("mapRemote #%d", i+1)
+		if !m.Enabled {
+			res.skip(where, "disabled")
+			continue
+		}
+		pat, err := charlesPattern(m.Source)
+		if err != nil {
+			res.skip(where, "%v", err)
+			continue
+		}
+		if m.PreserveHost {
+			res.approx(where, "preserveHostHeader is not supported, Host becomes %s", m.Dest.Host)
+		}
+		dst := charlesURL(m.Dest)
+		if q := m.Dest.Query; q != "" {
+			// 通配来源会把剩余路径拼到目标后面，query 只能留给原请求
+			if strings.HasSuffix(pat, "*") {
+				res.approx(where, "destination query %q is dropped for a wildcard source, the request query is kept", q)
+			} else {
+				dst += "?" + q
+			}
+		}
+		res.add(where, pat+" "+rules.ActMapRemote+"://"+dst)
+	}
+}
+
+func (res *Result) charlesMapLocal(v *charlesMapLocal) {
+	res.comment("Charles Map Local")
+	for i, m := range v.Mappings {
+		where := fmt.Sprintf("mapLocal #%d", i+1)
+		if !m.Enabled {
+			res.skip(where, "disabled")
+			continue
+		}
+		pat, err := charlesPattern(m.Source)
+		if err != nil {
+			res.skip(where, "%v", err)
+			continue
+		}
+		if hasSpace(m.Dest) {
+			res.skip(where, "local path %q contains whitespace", m.Dest)
+			continue
+		}
+		res.add(where, pat+" "+rules.ActMapLocal+"://@"+m.Dest)
+	}
+}
+
+func (res *Result) charlesRewrite(v *charlesRewrite) {
+	for _, set := range v.Sets {
+		res.comment("Charles Rewrite: %s", set.Name)
+		if !set.Active {
+			res.skip(fmt.Sprintf("rewrite set %q", set.Name), "inactive")
+			continue
+		}
+
+		var acts []string
+		for ri, r := range set.Rules {
+			where := fmt.Sprintf("rewrite set %q rule #%d", set.Name, ri+1)
+			if !r.Active {
+				continue
+			}
+			a, err := charlesRewriteActions(r)
+			if err != nil {
+				res.skip(where, "%v", err)
+				continue
+			}
+			acts = append(acts, a...)
+		}
+		if len(acts) == 0 {
+			continue
+		}
+
+		for li, l := range set.Locations {
+			where := fmt.Sprintf("rewrite set %q location #%d", set.Name, li+1)
+			if !l.Enabled {
+				continue
+			}
+			pat, err := charlesPattern(l.Location)
+			if err != nil {
+				res.skip(where, "%v", err)
+				continue
+			}
+			res.add(where, pat+" "+strings.Join(acts, " "))
+		}
+	}
+}
+
+func charlesRewriteActions(r charlesRewriteRule) ([]string, error) {
+	if r.MatchValue != "" && r.RuleType != chStatus {
+		return nil, fmt.Errorf("value matching (%q) is not supported", r.MatchValue)
+	}
+	var sides []string
+	if r.MatchRequest {
+		sides = append(sides, rules.ActReqHeader)
+	}
+	if r.MatchResponse || !r.MatchRequest {
+		sides = append(sides, rules.ActRespHeader)
+	}
+
+	var op string
+	switch r.RuleType {
+	case chAddHeader:
+		op = "Add:" + r.NewHeader + "=" + r.NewValue
+	case chModifyHeader:
+		name := r.NewHeader
+		if name == "" {
+			name = r.MatchHeader
+		}
+		op = "Set:" + name + "=" + r.NewValue
+	case chRemoveHeader:
+		op = "Del:" + r.MatchHeader
+	case chStatus:
+		if r.MatchValue != "" {
+			return nil, fmt.Errorf("conditional status rewrite (%s → %s) is not supported", r.MatchValue, r.NewValue)
+		}
+		code, _, _ := strings.Cut(strings.TrimSpace(r.NewValue), " ")
+		return []string{rules.ActStatus + "://" + code}, nil
+	default:
+		name := charlesRuleTypes[r.RuleType]
+		if name == "" {
+			name = fmt.Sprint(r.RuleType)
+		}
+		return nil, fmt.Errorf("rewrite type %s is not supported", name)
+	}
+	if hasSpace(op) {
+		return nil, fmt.Errorf("header value %q contains whitespace", r.NewValue)
+	}
+
+	out := make([]string, len(sides))
+	for i, s := range sides {
+		out[i] = s + "://" + op
+	}
+	return out, nil
+}
+
+// charlesPattern: Charles 的 path 为空表示任意路径，转成 "/*" 以便映射时拼接后缀
+func charlesPattern(l charlesLoc) (string, error) {
+	if l.Query != "" {
+		return "", fmt.Errorf("query matching %q is not supported", l.Query)
+	}
+	host := l.Host
+	if host == "*" {
+		host = ""
+	}
+	if host != "" && l.Port != "" && l.Port != "80" && l.Port != "443" && l.Port != "*" {
+		host += ":" + l.Port
+	}
+	path := l.Path
+	if path == "" || path == "*" {
+		path = "/*"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if hasSpace(host + path) {
+		return "", fmt.Errorf("location %q contains whitespace", host+path)
+	}
+	return host + path, nil
+}
+
+func charlesURL(l charlesLoc) string {
+	scheme := l.Protocol
+	if scheme == "" {
+		scheme = "http"
+	}
+	host := l.Host
+	if l.Port != "" && !(scheme == "http" && l.Port == "80") && !(scheme == "https" && l.Port == "443") {
+		host += ":" + l.Port
+	}
+	return scheme + "://" + host + l.Path
+}
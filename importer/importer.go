@@ -0,0 +1,80 @@
+// Package importer 把其他调试代理的规则转换为 rules.txt DSL
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+// Result 是一次导入的结果：可直接写入 rules.txt 的行 + 无法转换的说明
+type Result struct {
+	Lines   []string // DSL 行（含 "# ..." 注释）
+	Rules   int      // 有效规则条数
+	Skipped []string // 未导入的条目，"位置: 原因"
+	Approx  []string // 已导入但语义有损的条目
+}
+
+// Options 控制导入时的附加行为
+type Options struct {
+	AssetDir string // 内联 body 落盘目录；为空时无法转换含空白的内联 body
+}
+
+// Import 按来源格式转换：whistle / charles / proxyman
+func Import(from string, data []byte, opts Options) (*Result, error) {
+	switch strings.ToLower(from) {
+	case "whistle":
+		return fromWhistle(data), nil
+	case "charles":
+		return fromCharles(data)
+	case "proxyman":
+		return fromProxyman(data, opts)
+	}
+	return nil, fmt.Errorf("unknown source %q (want whistle, charles or proxyman)", from)
+}
+
+// add 校验后追加一行规则；校验失败记入 Skipped
+func (r *Result) add(where, line string) {
+	if err := rules.CheckLine(line); err != nil {
+		r.skip(where, "%v", err)
+		return
+	}
+	r.Lines = append(r.Lines, line)
+	r.Rules++
+}
+
+func (r *Result) comment(format string, a ...any) {
+	r.Lines = append(r.Lines, "# "+fmt.Sprintf(format, a...))
+}
+
+func (r *Result) skip(where, format string, a ...any) {
+	r.Skipped = append(r.Skipped, where+": "+fmt.Sprintf(format, a...))
+}
+
+func (r *Result) approx(where, format string, a ...any) {
+	r.Approx = append(r.Approx, where+": "+fmt.Sprintf(format, a...))
+}
+
+// Text 返回 rules.txt 内容
+func (r *Result) Text() string {
+	if len(r.Lines) == 0 {
+		return ""
+	}
+	return strings.Join(r.Lines, "\n") + "\n"
+}
+
+// Summary 返回人类可读的导入摘要
+func (r *Result) Summary() string {
+	s := fmt.Sprintf("%d rule(s) imported, %d unsupported, %d approximated", r.Rules, len(r.Skipped), len(r.Approx))
+	for _, sk := range r.Skipped {
+		s += "\n  ✗ " + sk
+	}
+	for _, ap := range r.Approx {
+		s += "\n  ~ " + ap
+	}
+	return s
+}
+
+// hasSpace DSL 以空白分隔，参数不能含空白
+func hasSpace(s string) bool { return strings.ContainsAny(s, " \t\r\n") }
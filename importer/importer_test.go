@@ -0,0 +1,193 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// check 比较生成的规则行（不含注释）和 Skipped / Approx 的条数
+func check(t *testing.T, name string, res *Result, want []string, skipped, approx int) {
+	t.Helper()
+	var got []string
+	for _, l := range res.Lines {
+		if !strings.HasPrefix(l, "#") {
+			got = append(got, l)
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("%s: lines\n%s\nwant\n%s", name, strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if res.Rules != len(want) || len(res.Skipped) != skipped || len(res.Approx) != approx {
+		t.Errorf("%s: %s\nwant %d skipped, %d approximated", name, res.Summary(), skipped, approx)
+	}
+}
+
+func TestWhistle(t *testing.T) {
+	cases := []struct {
+		name, in        string
+		want            []string
+		skipped, approx int
+	}{
+		{"map remote", "www.a.com/api https://b.com/api", []string{"www.a.com/api* mapRemote://https://b.com/api"}, 0, 0},
+		{"exact pattern", "$a.com/ping statusCode://204", []string{"a.com/ping status://204"}, 0, 0},
+		{"scheme in pattern", "https://a.com redirect://https://b.com/", []string{"a.com/* redirect://https://b.com/"}, 0, 0},
+		{"host line", "127.0.0.1:8080 a.com b.com", []string{
+			"a.com/* mapRemote://http://127.0.0.1:8080/",
+			"b.com/* mapRemote://http://127.0.0.1:8080/",
+		}, 0, 1},
+		{"local file and inline", "a.com/x file:///tmp/x.json\nb.com/y file://(ok)", []string{
+			"a.com/x* mapLocal://@/tmp/x.json",
+			"b.com/y* mapLocal://ok",
+		}, 0, 0},
+		{"headers and filters", "a.com resHeaders://(x-a=1&x-b=2) reqCookies://({\"s\":\"1\"}) includeFilter://m:post includeFilter://h:X-Env=stag", []string{
+			"a.com/* respHeader://Set:x-a=1 respHeader://Set:x-b=2 reqCookies://Set:s=1 method:POST header:X-Env=stag",
+		}, 0, 0},
+		{"auth", "a.com auth://u:p", []string{"a.com/* auth://basic:u:p"}, 0, 0},
+		{"comments", "# note\na.com statusCode://500 # trailing", []string{"a.com/* status://500"}, 0, 0},
+		{"unsupported operator", "a.com reqDelay://100", nil, 1, 0},
+		{"negated pattern", "!a.com statusCode://500", nil, 1, 0},
+		{"regexp URL", "/a\\.com/ statusCode://500", nil, 1, 0},
+		{"whistle value", "a.com file://{body}", nil, 1, 0},
+		{"inline block", "a.com file://{x}\n``` x\nhello\n```\nb.com statusCode://204", []string{"b.com/* status://204"}, 2, 0},
+		{"no operator", "a.com b.com", nil, 1, 0},
+		{"invalid result", "a.com statusCode://abc", nil, 1, 0},
+	}
+	for _, c := range cases {
+		res, err := Import("whistle", []byte(c.in), Options{})
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		check(t, c.name, res, c.want, c.skipped, c.approx)
+	}
+}
+
+const charlesXML = `<?xml version="1.0" encoding="UTF-8"?>
+<charles-export>
+<mapRemote>
+  <mappings>
+    <mapMapping>
+      <sourceLocation><host>a.com</host><path>/api/*</path></sourceLocation>
+      <destLocation><protocol>https</protocol><host>b.com</host><port>8443</port><path>/v2</path></destLocation>
+      <preserveHostHeader>true</preserveHostHeader>
+      <enabled>true</enabled>
+    </mapMapping>
+    <mapMapping>
+      <sourceLocation><host>c.com</host><query>x=1</query></sourceLocation>
+      <destLocation><host>d.com</host></destLocation>
+      <enabled>true</enabled>
+    </mapMapping>
+    <mapMapping>
+      <sourceLocation><host>h.com</host><path>/old</path></sourceLocation>
+      <destLocation><host>i.com</host><path>/new</path><query>v=2</query></destLocation>
+      <enabled>true</enabled>
+    </mapMapping>
+    <mapMapping>
+      <sourceLocation><host>j.com</host></sourceLocation>
+      <destLocation><host>k.com</host><query>v=2</query></destLocation>
+      <enabled>true</enabled>
+    </mapMapping>
+    <mapMapping>
+      <sourceLocation><host>e.com</host></sourceLocation>
+      <destLocation><host>f.com</host></destLocation>
+      <enabled>false</enabled>
+    </mapMapping>
+  </mappings>
+</mapRemote>
+<mapLocal>
+  <mappings>
+    <mapLocalMapping>
+      <sourceLocation><host>*</host><port>8080</port><path>static/app.js</path></sourceLocation>
+      <dest>/tmp/app.js</dest>
+      <enabled>true</enabled>
+    </mapLocalMapping>
+  </mappings>
+</mapLocal>
+<rewrite>
+  <sets>
+    <rewriteSet>
+      <active>true</active>
+      <name>headers</name>
+      <hosts><locationPatterns>
+        <locationMatch><location><host>g.com</host><port>8080</port></location><enabled>true</enabled></locationMatch>
+        <locationMatch><location><host>g.com</host><query>a=1</query></location><enabled>true</enabled></locationMatch>
+      </locationPatterns></hosts>
+      <rules>
+        <rewriteRule><active>true</active><ruleType>1</ruleType><newHeader>X-A</newHeader><newValue>1</newValue><matchRequest>true</matchRequest></rewriteRule>
+        <rewriteRule><active>true</active><ruleType>3</ruleType><matchHeader>Cookie</matchHeader><matchRequest>true</matchRequest><matchResponse>true</matchResponse></rewriteRule>
+        <rewriteRule><active>true</active><ruleType>11</ruleType><newValue>503 Service Unavailable</newValue></rewriteRule>
+        <rewriteRule><active>true</active><ruleType>7</ruleType></rewriteRule>
+        <rewriteRule><active>true</active><ruleType>2</ruleType><matchHeader>X-B</matchHeader><newValue>two words</newValue></rewriteRule>
+        <rewriteRule><active>false</active><ruleType>1</ruleType><newHeader>X-Off</newHeader></rewriteRule>
+      </rules>
+    </rewriteSet>
+  </sets>
+</rewrite>
+</charles-export>`
+
+func TestCharles(t *testing.T) {
+	res, err := Import("charles", []byte(charlesXML), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "charles", res, []string{
+		"a.com/api/* mapRemote://https://b.com:8443/v2",
+		"h.com/old mapRemote://http://i.com/new?v=2",
+		"j.com/* mapRemote://http://k.com",
+		"/static/app.js mapLocal://@/tmp/app.js",
+		"g.com:8080/* reqHeader://Add:X-A=1 reqHeader://Del:Cookie respHeader://Del:Cookie status://503",
+	}, 5, 2)
+	// 同一个 rewrite set 的条目都按名称标注
+	for _, sk := range res.Skipped {
+		if strings.HasPrefix(sk, "rewrite set") && !strings.HasPrefix(sk, `rewrite set "headers" `) {
+			t.Errorf("inconsistent location label: %s", sk)
+		}
+	}
+
+	if _, err := Import("charles", []byte("<charles-export/>"), Options{}); err == nil {
+		t.Error("expected an error for an export without supported sections")
+	}
+}
+
+func TestProxyman(t *testing.T) {
+	assets := t.TempDir()
+	in := `{"rules": [
+		{"name": "file", "url": "https://a.com/api", "isIncludingSubpaths": true, "localPath": "/tmp/a.json", "method": "post"},
+		{"name": "inline", "url": "b.com", "body": "{\"ok\":true}", "statusCode": 201},
+		{"name": "spaces", "url": "c.com/x", "body": "hello world"},
+		{"name": "off", "url": "d.com", "body": "x", "isEnabled": false},
+		{"name": "regex", "url": "e.com/.*", "body": "x", "isRegex": true},
+		{"name": "query", "url": "f.com/x?a=1", "body": "x"},
+		{"name": "empty", "url": "g.com"},
+		"junk"
+	]}`
+	res, err := Import("proxyman", []byte(in), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "proxyman", res, []string{
+		"a.com/api* mapLocal://@/tmp/a.json method:POST",
+		`b.com/ mapLocal://{"ok":true}`,
+	}, 6, 1)
+
+	res, err = Import("proxyman", []byte(in), Options{AssetDir: assets})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := filepath.Join(assets, "proxyman-3.body")
+	if !slices.Contains(res.Lines, "c.com/x mapLocal://@"+body) {
+		t.Errorf("inline body with spaces not saved: %q", res.Lines)
+	}
+	if b, err := os.ReadFile(body); err != nil || string(b) != "hello world" {
+		t.Errorf("asset = %q, %v", b, err)
+	}
+
+	if _, err := Import("proxyman", []byte(`{"other": 1}`), Options{}); err == nil {
+		t.Error("expected an error for JSON without a rule list")
+	}
+	if _, err := Import("fiddler", nil, Options{}); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+}
@@ -0,0 +1,139 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ---------- Proxyman: Map Local 导出（JSON） ----------
+ *
+ * 不同版本字段名略有差异，这里按别名宽松读取：
+ *   name, isEnabled/enabled, url, isRegex/regex, method,
+ *   isIncludingSubpaths/includeSubpaths, statusCode,
+ *   localPath/filePath/bodyFilePath, body
+ * 内联 body 需要 -assets 目录落盘后以 @file 引用。
+ */
+
+func fromProxyman(data []byte, opts Options) (*Result, error) {
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("proxyman: %v", err)
+	}
+	items, ok := root.([]any)
+	if obj, isObj := root.(map[string]any); isObj {
+		for _, k := range []string{"rules", "items", "mapLocal", "data"} {
+			if items, ok = obj[k].([]any); ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("proxyman: expected a list of map-local rules")
+	}
+
+	res := &Result{}
+	res.comment("Proxyman Map Local")
+	for i, it := range items {
+		m, _ := it.(map[string]any)
+		where := fmt.Sprintf("rule #%d", i+1)
+		if name := str(m, "name"); name != "" {
+			where = fmt.Sprintf("rule #%d %q", i+1, name)
+		}
+		res.proxymanRule(where, m, opts, i+1)
+	}
+	return res, nil
+}
+
+func (res *Result) proxymanRule(where string, m map[string]any, opts Options, n int) {
+	if m == nil {
+		res.skip(where, "not an object")
+		return
+	}
+	if en, ok := boolean(m, "isEnabled", "enabled"); ok && !en {
+		res.skip(where, "disabled")
+		return
+	}
+	if re, _ := boolean(m, "isRegex", "regex", "useRegex"); re {
+		res.skip(where, "regex URL matching cannot be expressed (rx:// matches the path only)")
+		return
+	}
+
+	pat := str(m, "url")
+	if i := strings.Index(pat, "://"); i >= 0 {
+		pat = pat[i+3:]
+	}
+	if pat == "" || strings.Contains(pat, "?") || hasSpace(pat) {
+		res.skip(where, "unsupported url %q", str(m, "url"))
+		return
+	}
+	if !strings.Contains(pat, "/") {
+		pat += "/"
+	}
+	if sub, _ := boolean(m, "isIncludingSubpaths", "includeSubpaths", "includingSubpaths"); sub && !strings.HasSuffix(pat, "*") {
+		pat += "*"
+	}
+
+	var src string
+	switch file, body := str(m, "localPath", "filePath", "bodyFilePath", "file"), str(m, "body"); {
+	case file != "":
+		if hasSpace(file) {
+			res.skip(where, "local path %q contains whitespace", file)
+			return
+		}
+		src = "@" + file
+	case body != "" && !hasSpace(body):
+		src = body
+	case body != "" && opts.AssetDir != "":
+		p := filepath.Join(opts.AssetDir, fmt.Sprintf("proxyman-%d.body", n))
+		if err := os.MkdirAll(opts.AssetDir, 0755); err != nil {
+			res.skip(where, "%v", err)
+			return
+		}
+		if err := os.WriteFile(p, []byte(body), 0644); err != nil {
+			res.skip(where, "%v", err)
+			return
+		}
+		src = "@" + p
+	case body != "":
+		res.skip(where, "inline body contains whitespace (pass -assets DIR to save it to a file)")
+		return
+	default:
+		res.skip(where, "no body or local file")
+		return
+	}
+
+	line := pat + " " + rules.ActMapLocal + "://" + src
+	if method := strings.ToUpper(str(m, "method")); method != "" && method != "ANY" {
+		line += " method:" + method
+	}
+	if code, ok := m["statusCode"].(float64); ok && code != 200 {
+		res.approx(where, "status code %d ignored (mapLocal always answers 200)", int(code))
+	}
+	if h, ok := m["headers"]; ok && h != nil {
+		res.approx(where, "custom response headers ignored")
+	}
+	res.add(where, line)
+}
+
+func str(m map[string]any, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := m[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func boolean(m map[string]any, keys ...string) (val, ok bool) {
+	for _, k := range keys {
+		if b, ok := m[k].(bool); ok {
+			return b, true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,229 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ---------- whistle: "pattern operator://value" ----------
+ *
+ * 支持：host 行（"1.2.3.4 a.com b.com" / "a.com 1.2.3.4:8080"）、host://、
+ * http(s):// 映射、file:// / xfile://、statusCode://、redirect://、auth://user:pass、reqHeaders:// / resHeaders://、
+ * reqCookies:// / resCookies://（内联 k=v）、
+ * includeFilter://m:METHOD / h:Key=Value。其余操作符与 ``` 内联值块会在摘要中列出。
+ */
+
+// 能识别的 whistle 操作符（含不支持的），用于区分 pattern 与 operator
+var whistleOps = map[string]bool{
+	"host": true, "xhost": true, "file": true, "xfile": true, "tpl": true, "xtpl": true,
+	"statusCode": true, "replaceStatus": true, "redirect": true, "reqHeaders": true, "resHeaders": true,
+	"reqCookies": true, "resCookies": true, "reqCors": true, "resCors": true, "reqDelay": true, "resDelay": true,
+	"reqSpeed": true, "resSpeed": true, "reqBody": true, "resBody": true, "reqPrepend": true, "resPrepend": true,
+	"reqAppend": true, "resAppend": true, "reqReplace": true, "resReplace": true, "reqMerge": true, "resMerge": true,
+	"htmlAppend": true, "htmlPrepend": true, "htmlBody": true, "jsAppend": true, "jsPrepend": true, "jsBody": true,
+	"cssAppend": true, "cssPrepend": true, "cssBody": true, "urlParams": true, "urlReplace": true, "method": true,
+	"auth": true, "ua": true, "referer": true, "proxy": true, "http-proxy": true, "https-proxy": true, "socks": true,
+	"pac": true, "weinre": true, "log": true, "filter": true, "ignore": true, "enable": true, "disable": true,
+	"includeFilter": true, "excludeFilter": true, "plugin": true, "rule": true, "pipe": true, "style": true,
+	"resType": true, "resCharset": true, "cache": true, "attachment": true, "forwardedFor": true, "responseFor": true,
+	"reqWrite": true, "resWrite": true, "reqWriteRaw": true, "resWriteRaw": true, "reqScript": true, "resScript": true,
+}
+
+func fromWhistle(data []byte) *Result {
+	res := &Result{}
+	inBlock := false
+	for n, raw := range strings.Split(string(data), "\n") {
+		where := fmt.Sprintf("line %d", n+1)
+		line := strings.TrimSpace(raw)
+		if strings.HasPrefix(line, "```") {
+			if !inBlock {
+				res.skip(where, "inline value block %q (save it to a file and use file://)", strings.TrimPrefix(line, "```"))
+			}
+			inBlock = !inBlock
+			continue
+		}
+		if inBlock || line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			res.Lines = append(res.Lines, line)
+			continue
+		}
+		if i := strings.Index(line, " #"); i >= 0 { // 行尾注释
+			line = strings.TrimSpace(line[:i])
+		}
+		res.whistleLine(where, strings.Fields(line))
+	}
+	return res
+}
+
+func (res *Result) whistleLine(where string, toks []string) {
+	var pats, acts, filters []string
+	for _, tok := range toks {
+		name, val, isOp := whistleOp(tok)
+		switch {
+		case isIPPort(tok):
+			name, val, isOp = "host", tok, true
+		case isOp && (name == "http" || name == "https" || name == "ws" || name == "wss") && len(pats) == 0:
+			isOp = false // 第一个 URL 视为 pattern
+		}
+		if !isOp {
+			pats = append(pats, tok)
+			continue
+		}
+
+		switch name {
+		case "host":
+			acts = append(acts, rules.ActMapRemote+"://http://"+val+"/")
+			res.approx(where, "host://%s mapped with mapRemote to http://%s (Host header / TLS not preserved)", val, val)
+		case "http", "https":
+			acts = append(acts, rules.ActMapRemote+"://"+tok)
+		case "file", "xfile":
+			if strings.HasPrefix(val, "{") {
+				res.skip(where, "%s references a whistle value %s", name, val)
+				return
+			}
+			if strings.HasPrefix(val, "(") && strings.HasSuffix(val, ")") {
+				acts = append(acts, rules.ActMapLocal+"://"+strings.Trim(val, "()"))
+			} else {
+				acts = append(acts, rules.ActMapLocal+"://@"+val)
+			}
+		case "statusCode":
+			acts = append(acts, rules.ActStatus+"://"+val)
+		case "redirect":
+			acts = append(acts, rules.ActRedirect+"://"+val)
+		case "auth":
+			if strings.HasPrefix(val, "{") || !strings.Contains(val, ":") {
+				res.skip(where, "auth://%s (only inline user:pass supported)", val)
+				return
+			}
+			acts = append(acts, rules.ActAuth+"://basic:"+val)
+		case "reqHeaders", "resHeaders", "reqCookies", "resCookies":
+			act := map[string]string{
+				"reqHeaders": rules.ActReqHeader, "resHeaders": rules.ActRespHeader,
+				"reqCookies": rules.ActReqCookies, "resCookies": rules.ActResCookies,
+			}[name]
+			kvs, ok := whistleKV(val)
+			if !ok {
+				res.skip(where, "%s value %q (only inline k=v&k2=v2 or (json) supported)", name, val)
+				return
+			}
+			for _, kv := range kvs {
+				acts = append(acts, act+"://Set:"+kv)
+			}
+		case "includeFilter":
+			f, ok := whistleFilter(val)
+			if !ok {
+				res.skip(where, "includeFilter://%s (only m:METHOD and h:Key=Value supported)", val)
+				return
+			}
+			filters = append(filters, f)
+		default:
+			res.skip(where, "operator %s:// not supported", name)
+			return
+		}
+	}
+
+	if len(pats) == 0 || len(acts) == 0 {
+		res.skip(where, "need both a pattern and an operator: %q", strings.Join(toks, " "))
+		return
+	}
+	for _, p := range pats {
+		dp, err := whistlePattern(p)
+		if err != nil {
+			res.skip(where, "pattern %q: %v", p, err)
+			continue
+		}
+		res.add(where, strings.Join(append(append([]string{dp}, acts...), filters...), " "))
+	}
+}
+
+// whistleOp 解析 "name://value"
+func whistleOp(tok string) (name, val string, ok bool) {
+	i := strings.Index(tok, "://")
+	if i <= 0 {
+		return "", "", false
+	}
+	name, val = tok[:i], tok[i+3:]
+	switch name {
+	case "http", "https", "ws", "wss":
+		return name, val, true
+	}
+	return name, val, whistleOps[name]
+}
+
+// whistlePattern 把 whistle pattern 转成 DSL pattern（whistle 普通 URL 为前缀匹配）
+func whistlePattern(p string) (string, error) {
+	switch {
+	case strings.HasPrefix(p, "!"):
+		return "", fmt.Errorf("negated patterns are not supported")
+	case strings.HasPrefix(p, "/") && strings.LastIndexByte(p, '/') > 0:
+		return "", fmt.Errorf("full-URL regexp cannot be expressed (rx:// matches the path only)")
+	}
+
+	exactMatch := strings.HasPrefix(p, "$")
+	p = strings.TrimPrefix(strings.TrimPrefix(p, "$"), "^")
+	if i := strings.Index(p, "://"); i >= 0 {
+		p = p[i+3:]
+	}
+	if strings.HasPrefix(p, "//") { // "//a.com/x" 任意 scheme
+		p = p[2:]
+	}
+	if strings.Contains(p, "?") {
+		return "", fmt.Errorf("query string in pattern is not supported")
+	}
+	if !strings.Contains(p, "/") {
+		p += "/"
+	}
+	if !exactMatch && !strings.HasSuffix(p, "*") {
+		p += "*"
+	}
+	return p, nil
+}
+
+// whistleKV 解析内联 header 值：k=v&k2=v2 或 ({"k":"v"})
+func whistleKV(val string) ([]string, bool) {
+	val = strings.TrimSuffix(strings.TrimPrefix(val, "("), ")")
+	if strings.HasPrefix(val, "{") {
+		var m map[string]string
+		if json.Unmarshal([]byte(val), &m) != nil {
+			return nil, false
+		}
+		var out []string
+		for k, v := range m {
+			out = append(out, k+"="+v)
+		}
+		sort.Strings(out)
+		return out, len(out) > 0
+	}
+	var out []string
+	for _, kv := range strings.Split(val, "&") {
+		if !strings.Contains(kv, "=") {
+			return nil, false
+		}
+		out = append(out, kv)
+	}
+	return out, len(out) > 0
+}
+
+func whistleFilter(val string) (string, bool) {
+	switch {
+	case strings.HasPrefix(val, "m:"):
+		return "method:" + strings.ToUpper(val[2:]), true
+	case strings.HasPrefix(val, "h:") && strings.Contains(val, "="):
+		return "header:" + val[2:], true
+	}
+	return "", false
+}
+
+func isIPPort(s string) bool {
+	if h, _, err := net.SplitHostPort(s); err == nil {
+		s = h
+	}
+	return net.ParseIP(s) != nil
+}
@@ -18,3 +18,6 @@ func D(format string, v ...any) {
 func I(format string, v ...any) {
 	log.Printf(format, v...)
 }
+
+// Debugging 报告是否开启了 GW_DEBUG，供需要额外开销的调试输出提前判断
+func Debugging() bool { return debug }
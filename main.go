@@ -18,17 +18,70 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/sonacy/go-whistle-lite/grpcx"
 	"github.com/sonacy/go-whistle-lite/internal/logx"
+	"github.com/sonacy/go-whistle-lite/mitm"
 	"github.com/sonacy/go-whistle-lite/proxy"
 	"github.com/sonacy/go-whistle-lite/rules"
 	"github.com/sonacy/go-whistle-lite/sysproxy"
+	"github.com/sonacy/go-whistle-lite/transport"
 )
 
 /* ---------- flags ---------- */
-var port = flag.Int("port", 8899, "listening port")
+var (
+	port        = flag.Int("port", 8899, "listening port")
+	statsEvery  = flag.Duration("stats-every", 0, "log a rule hit summary at this interval (0 = off)")
+	rulesFile   = flag.String("rules", "", "rule file: .txt DSL or .yaml/.yml/.json (default: first of rules.txt, rules.yaml, rules.yml, rules/rules.json)")
+	upstreamTLS = flag.String("upstream-tls", "insecure", "upstream certificate check: insecure or verify (per rule: tls://)")
+	upstreamCA  = flag.String("upstream-ca", "", "extra PEM CA bundle trusted for upstream TLS")
+	upProto     = flag.String("upstream-proto", "auto", "upstream protocol: auto (ALPN), h1, h2 or mirror (follow the client)")
+	downProto   = flag.String("downstream-proto", "auto", "protocols offered to MITM clients: auto (h2 + http/1.1) or h1")
+	leafKey     = flag.String("leaf-key", "ecdsa", "key type of forged host certs: ecdsa (P-256) or rsa")
+	certCache   = flag.Bool("cert-cache", false, "persist forged host certs under ~/go-whistle-lite/certs/")
+	wildcard    = flag.Bool("wildcard-certs", false, "forge one *.parent cert shared by sibling subdomains")
+	mirrorCerts = flag.Bool("mirror-certs", false, "handshake upstream first and copy its cert fields and ALPN into the forged leaf")
+	caCert      = flag.String("ca-cert", "", "bring-your-own CA certificate (PEM root or intermediate, may include the chain)")
+	caKey       = flag.String("ca-key", "", "private key of -ca-cert (PKCS#1, SEC1 or PKCS#8, optionally encrypted)")
+	caKeyPass   = flag.String("ca-key-pass", os.Getenv("GW_CA_KEY_PASS"), "password of an encrypted -ca-key (default $GW_CA_KEY_PASS)")
+	keyLogFile  = flag.String("keylog", os.Getenv("SSLKEYLOGFILE"), "append TLS session keys in NSS key log format for Wireshark (default $SSLKEYLOGFILE)")
+	protosets   = flag.String("protoset", "", "comma-separated .protoset files for decoding gRPC messages in debug logs and grpc:// json=")
+	seed        = flag.Uint64("seed", 0, "random seed for pct: modifiers and fault percentages (0 = random)")
+)
 
 func main() {
+	if runCommand() {
+		return
+	}
 	flag.Parse()
+	if *rulesFile != "" {
+		rules.SetFile(*rulesFile)
+	}
+	rules.SetSeed(*seed)
+	if err := transport.SetKeyLog(*keyLogFile); err != nil {
+		log.Fatalf("[gw-lite] keylog: %v", err)
+	}
+	if err := transport.Configure(*upstreamTLS, *upstreamCA); err != nil {
+		log.Fatalf("[gw-lite] %v", err)
+	}
+	if err := transport.SetProto(*upProto); err != nil {
+		log.Fatalf("[gw-lite] %v", err)
+	}
+	if *protosets != "" {
+		if err := grpcx.SetProtosets(strings.Split(*protosets, ",")); err != nil {
+			log.Fatalf("[gw-lite] protoset: %v", err)
+		}
+	}
+	if err := mitm.Configure(mitm.Options{
+		LeafKey: *leafKey, Persist: *certCache, Wildcard: *wildcard,
+		Mirror: *mirrorCerts, Downstream: *downProto,
+		CACert: *caCert, CAKey: *caKey, CAKeyPass: *caKeyPass,
+	}); err != nil {
+		log.Fatalf("[gw-lite] %v", err)
+	}
+	if _, err := mitm.InitCA(); err != nil {
+		log.Fatalf("[gw-lite] %v", err)
+	}
+	mitm.Prewarm(rules.Hosts())
 	addr := fmt.Sprintf(":%d", *port)
 
 	/* ---- ① 绑定端口，若占用则尝试强制释放 ---- */
@@ -50,7 +103,7 @@ func main() {
 
 	/* ---- ③ 创建服务器 ---- */
 	srv := &http.Server{
-		Handler:           http.HandlerFunc(proxy.HandleRequest),
+		Handler:           proxy.Handler(),
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 	srv.SetKeepAlivesEnabled(false) // 避免 TIME_WAIT 占端口
@@ -74,6 +127,8 @@ func main() {
 		}
 	}()
 
+	rules.LogStats(*statsEvery)
+
 	/* ---- ⑤ Serve ---- */
 	logx.D("[gw-lite] listening on %s", addr)
 	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
@@ -0,0 +1,301 @@
+package mitm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youmark/pkcs8"
+
+	"github.com/sonacy/go-whistle-lite/truststore"
+)
+
+const (
+	rootYears   = 5
+	rsaBitsRoot = 4096
+)
+
+// CA 是签发叶子证书的证书与私钥，可以是自签根，也可以是公司下发的中间证书
+type CA struct {
+	Cert     *x509.Certificate
+	Key      crypto.Signer
+	Chain    [][]byte          // 叶子之后发送的链：中间证书本身及其上级（不含自签根）
+	Root     *x509.Certificate // 客户端需要信任的证书：文件中的自签根，没有时为 Cert
+	CertFile string
+	KeyFile  string
+}
+
+var (
+	caOnce sync.Once
+	ca     *CA
+	caErr  error
+)
+
+// currentCA 按 Options 懒加载 CA；出错后不再重试，错误会在每次签发时返回
+func currentCA() (*CA, error) {
+	caOnce.Do(func() { ca, caErr = LoadCA(opts.CACert, opts.CAKey, opts.CAKeyPass) })
+	return ca, caErr
+}
+
+// InitCA 在启动时加载 CA，便于尽早报告错误
+func InitCA() (*CA, error) { return currentCA() }
+
+// dataDir 是根证书与叶子证书缓存所在的目录；sudo 下取调用者的 home，而不是 /root
+func dataDir() string { return filepath.Join(truststore.InvokingHome(), "go-whistle-lite") }
+
+// DefaultCAPaths 返回内置根证书的位置
+func DefaultCAPaths() (cert, key string) {
+	dir := dataDir()
+	return filepath.Join(dir, "rootCA.pem"), filepath.Join(dir, "rootCA.key")
+}
+
+// LoadCA 读取 CA；两个路径都为空时使用默认位置，默认文件不存在则生成新的根证书
+func LoadCA(certFile, keyFile, pass string) (*CA, error) {
+	if certFile == "" && keyFile == "" {
+		certFile, keyFile = DefaultCAPaths()
+		_, cErr := os.Stat(certFile)
+		_, kErr := os.Stat(keyFile)
+		if errors.Is(cErr, os.ErrNotExist) && errors.Is(kErr, os.ErrNotExist) {
+			return GenerateCA(certFile, keyFile)
+		}
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("ca: both -ca-cert and -ca-key are required")
+	}
+
+	c, err := LoadCACert(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("ca key: %v", err)
+	}
+	if c.Key, err = parseKey(keyPEM, pass); err != nil {
+		return nil, fmt.Errorf("ca key %s: %v", keyFile, err)
+	}
+	c.KeyFile = keyFile
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("ca %s: %v", certFile, err)
+	}
+	log.Printf("[mitm] loaded CA %s (%s)", certFile, c.Cert.Subject.CommonName)
+	return c, nil
+}
+
+// LoadCACert 只读取证书（含链），不需要私钥，也不会生成新 CA；供 install / export 等使用
+func LoadCACert(certFile string) (*CA, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("ca cert: %v", err)
+	}
+	certs, err := parseCerts(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("ca cert %s: %v", certFile, err)
+	}
+	c := &CA{Cert: certs[0], Root: certs[0], CertFile: certFile}
+	switch {
+	case c.Cert.IsCA:
+	case c.Cert.BasicConstraintsValid:
+		return nil, fmt.Errorf("ca %s: certificate is not a CA (basicConstraints CA:FALSE)", certFile)
+	case !selfSigned(c.Cert):
+		return nil, fmt.Errorf("ca %s: certificate is not a CA (no basicConstraints)", certFile)
+	default: // 早期版本生成的根证书没有 basicConstraints 扩展，自签名的仍按根证书使用
+		log.Printf("[mitm] CA %s has no basicConstraints; run `gw-lite ca regenerate` if clients reject it", certFile)
+	}
+	for _, x := range certs {
+		if !selfSigned(x) { // 根证书客户端本地已有，不必发送
+			c.Chain = append(c.Chain, x.Raw)
+		} else {
+			c.Root = x
+		}
+	}
+	return c, nil
+}
+
+func (c *CA) validate() error {
+	switch {
+	case c.Cert.KeyUsage != 0 && c.Cert.KeyUsage&x509.KeyUsageCertSign == 0:
+		return fmt.Errorf("certificate lacks the keyCertSign usage")
+	case time.Now().After(c.Cert.NotAfter):
+		return fmt.Errorf("certificate expired on %s", c.Cert.NotAfter.Format(time.DateOnly))
+	}
+	pub, ok := c.Key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(c.Cert.PublicKey) {
+		return fmt.Errorf("private key does not match the certificate")
+	}
+	return nil
+}
+
+// IsIntermediate 报告 CA 是否为中间证书（叶子证书会带上它组成完整链）
+func (c *CA) IsIntermediate() bool { return !selfSigned(c.Cert) }
+
+func selfSigned(x *x509.Certificate) bool {
+	// 只验签名：CheckSignatureFrom 会拒绝没有 basicConstraints 的旧根证书
+	return bytes.Equal(x.RawIssuer, x.RawSubject) && x.CheckSignature(x.SignatureAlgorithm, x.RawTBSCertificate, x.Signature) == nil
+}
+
+// Fingerprint 返回 SHA-256 指纹（AA:BB:… 形式）
+func Fingerprint(x *x509.Certificate) string {
+	sum := sha256.Sum256(x.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+/* ---------- PEM 解析 ---------- */
+
+func parseCerts(b []byte) ([]*x509.Certificate, error) {
+	var out []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, b = pem.Decode(b); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		x, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, x)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no CERTIFICATE block found")
+	}
+	return out, nil
+}
+
+// parseKey 支持 PKCS#1 / SEC1 EC / PKCS#8，以及传统 PEM 加密与加密 PKCS#8
+func parseKey(b []byte, pass string) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		if block, b = pem.Decode(b); block == nil {
+			return nil, fmt.Errorf("no private key block found")
+		}
+		der := block.Bytes
+		// 传统 PEM 加密（Proc-Type: 4,ENCRYPTED），openssl -des3 等旧格式
+		if x509.IsEncryptedPEMBlock(block) {
+			if pass == "" {
+				return nil, errEncrypted
+			}
+			var err error
+			if der, err = x509.DecryptPEMBlock(block, []byte(pass)); err != nil {
+				return nil, fmt.Errorf("decrypt: %v", err)
+			}
+		}
+
+		var (
+			key any
+			err error
+		)
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(der)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(der)
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(der)
+		case "ENCRYPTED PRIVATE KEY":
+			if pass == "" {
+				return nil, errEncrypted
+			}
+			key, err = pkcs8.ParsePKCS8PrivateKey(der, []byte(pass))
+		default:
+			continue // 例如 EC PARAMETERS
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", strings.ToLower(block.Type), err)
+		}
+		s, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", key)
+		}
+		return s, nil
+	}
+}
+
+var errEncrypted = errors.New("key is encrypted: pass -ca-key-pass or set GW_CA_KEY_PASS")
+
+/* ---------- 生成 / 轮换 ---------- */
+
+// GenerateCA 生成新的自签根证书并写入 certFile / keyFile
+func GenerateCA(certFile, keyFile string) (*CA, error) {
+	key, err := rsa.GenerateKey(rand.Reader, rsaBitsRoot)
+	if err != nil {
+		return nil, fmt.Errorf("generate root key: %v", err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<61))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization:       []string{"go-whistle-lite"},
+			OrganizationalUnit: []string{"Proxy MITM"},
+			CommonName:         "go-whistle-lite Root CA",
+		},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().AddDate(rootYears, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            0,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("create root cert: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return nil, err
+	}
+	cBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	kBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(certFile, cBytes, 0600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(keyFile, kBytes, 0600); err != nil {
+		return nil, err
+	}
+	log.Printf("[mitm] generated new root CA %s", certFile)
+	fmt.Println("\n⚠️  Import the following RootCA into your system/ browser trust store:\n", certFile)
+
+	return &CA{Cert: cert, Root: cert, Key: key, CertFile: certFile, KeyFile: keyFile}, nil
+}
+
+// RegenerateCA 轮换内置根证书：旧文件改名备份，已缓存的叶子证书一并清除
+func RegenerateCA() (*CA, error) {
+	certFile, keyFile := DefaultCAPaths()
+	stamp := time.Now().Format("20060102-150405")
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Rename(f, f+".bak-"+stamp); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if err := os.RemoveAll(leafDir()); err != nil {
+		return nil, err
+	}
+	return GenerateCA(certFile, keyFile)
+}
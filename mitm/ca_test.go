@@ -0,0 +1,102 @@
+package mitm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCA 按 tmpl 写出证书与 PKCS#8 私钥；parent 为空时自签名
+func writeCA(t *testing.T, tmpl *x509.Certificate, parent *x509.Certificate, parentKey crypto.Signer) (cert, key string, c *x509.Certificate, k crypto.Signer) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore, tmpl.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = tmpl, priv
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &priv.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(priv)
+	dir := t.TempDir()
+	cert, key = filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca.key")
+	os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	c, _ = x509.ParseCertificate(der)
+	return cert, key, c, priv
+}
+
+func TestLoadCA(t *testing.T) {
+	root := &x509.Certificate{Subject: pkix.Name{CommonName: "root"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}
+	rootCert, rootKeyFile, rootX, rootKey := writeCA(t, root, nil, nil)
+	_, otherKey, _, _ := writeCA(t, &x509.Certificate{Subject: pkix.Name{CommonName: "other"}, IsCA: true, BasicConstraintsValid: true}, nil, nil)
+	// 早期版本生成的根证书：IsCA 但没有 basicConstraints 扩展
+	legacyCert, legacyKey, _, _ := writeCA(t, &x509.Certificate{Subject: pkix.Name{CommonName: "legacy"}, IsCA: true, KeyUsage: x509.KeyUsageCertSign}, nil, nil)
+	leafCert, leafKey, _, _ := writeCA(t, &x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}, BasicConstraintsValid: true}, nil, nil)
+	orphanCert, orphanKey, _, _ := writeCA(t, &x509.Certificate{Subject: pkix.Name{CommonName: "orphan"}}, rootX, rootKey)
+	noSignCert, noSignKey, _, _ := writeCA(t, &x509.Certificate{Subject: pkix.Name{CommonName: "nosign"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageDigitalSignature}, nil, nil)
+
+	cases := []struct {
+		name, cert, key, err string
+	}{
+		{"root", rootCert, rootKeyFile, ""},
+		{"legacy root", legacyCert, legacyKey, ""},
+		{"CA:FALSE", leafCert, leafKey, "CA:FALSE"},
+		{"not self-signed, no basicConstraints", orphanCert, orphanKey, "no basicConstraints"},
+		{"no keyCertSign", noSignCert, noSignKey, "keyCertSign"},
+		{"key mismatch", rootCert, otherKey, "does not match"},
+		{"missing key", rootCert, rootKeyFile + ".nope", "ca key"},
+		{"key without cert", "", rootKeyFile, "both -ca-cert and -ca-key"},
+	}
+	for _, c := range cases {
+		ca, err := LoadCA(c.cert, c.key, "")
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: %v", c.name, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%s: error %v, want %q", c.name, err, c.err)
+		case c.err == "" && ca.Key == nil:
+			t.Errorf("%s: key not loaded", c.name)
+		}
+	}
+
+	// install / export 只需要证书
+	if ca, err := LoadCACert(rootCert); err != nil || ca.Key != nil || ca.Root.Subject.CommonName != "root" {
+		t.Errorf("LoadCACert = %+v, %v", ca, err)
+	}
+}
+
+func TestLegacyRootIssuesAndReloadsLeaves(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SUDO_USER", "")
+	saved := opts
+	t.Cleanup(func() { opts = saved })
+	opts = Options{LeafKey: "ecdsa", Persist: true}
+
+	cert, key, _, _ := writeCA(t, &x509.Certificate{Subject: pkix.Name{CommonName: "legacy"}, IsCA: true, KeyUsage: x509.KeyUsageCertSign}, nil, nil)
+	ca, err := LoadCA(cert, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issueLeaf(ca, "a.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadLeaf(ca, "a.example.com"); err != nil {
+		t.Errorf("cached leaf of a legacy root was rejected: %v", err)
+	}
+}
@@ -1,58 +1,159 @@
 package mitm
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
-	"log"
 	"math/big"
+	"net"
 	"os"
 	"path/filepath"
-	"sync"
+	"strings"
 	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2"
+	"golang.org/x/net/publicsuffix"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
 )
 
 const (
-	rootYears   = 5
 	hostYears   = 1
-	rsaBitsRoot = 4096
 	rsaBitsHost = 2048
 )
 
-var (
-	rootOnce sync.Once
-	rootKey  *rsa.PrivateKey
-	rootCert *x509.Certificate
-)
+// Options 控制根证书与叶子证书的签发
+type Options struct {
+	LeafKey  string // "ecdsa"（默认，P-256）或 "rsa"
+	Persist  bool   // 把签发的叶子证书存到 ~/go-whistle-lite/certs/
+	Wildcard bool   // 子域名共用 *.parent 证书，减少密钥生成
+	Mirror   bool   // 先连上游，复制真实证书的字段与 ALPN
+
+	Downstream string // 向客户端提供的协议："auto"（h2 + http/1.1）或 "h1"
 
-type tlsCertPair struct {
-	CertPEM []byte
-	KeyPEM  []byte
+	CACert    string // 自带 CA（根或中间证书）；为空时使用 ~/go-whistle-lite/rootCA.pem
+	CAKey     string
+	CAKeyPass string // 加密私钥的口令
 }
 
-var certLRU *lru.Cache[string, tlsCertPair]
+var opts = Options{LeafKey: "ecdsa"}
+
+// Configure 在启动时调用
+func Configure(o Options) error {
+	switch o.LeafKey {
+	case "":
+		o.LeafKey = "ecdsa"
+	case "ecdsa", "rsa":
+	default:
+		return fmt.Errorf("leaf key %q (want ecdsa or rsa)", o.LeafKey)
+	}
+	switch o.Downstream {
+	case "", "auto", "h1":
+	default:
+		return fmt.Errorf("downstream proto %q (want auto or h1)", o.Downstream)
+	}
+	opts = o
+	return nil
+}
+
+var (
+	certLRU *lru.Cache[string, *tls.Certificate]
+	issuing singleflight.Group // 同一 host 并发 CONNECT 只签发一次
+)
 
 func init() {
-	// LRU 1000 hosts ≈ 40-60 MB
-	certLRU, _ = lru.New[string, tlsCertPair](1000)
+	// 已解析的证书，1000 hosts
+	certLRU, _ = lru.New[string, *tls.Certificate](1000)
 }
 
 /* ----------------------------------------------------
  *  Public entry used by mitm.go
  * --------------------------------------------------*/
-func getHostCert(host string) (tlsCertPair, error) {
-	rootOnce.Do(initRootCA)
+func getHostCert(host string) (*tls.Certificate, error) {
+	ca, err := currentCA()
+	if err != nil {
+		return nil, err
+	}
+	name := certName(host)
+	if c, ok := certLRU.Get(name); ok {
+		return c, nil
+	}
+	v, err, _ := issuing.Do(name, func() (any, error) {
+		if c, ok := certLRU.Get(name); ok { // 等待期间已被其他调用签发
+			return c, nil
+		}
+		c, err := loadLeaf(ca, name)
+		if err != nil {
+			if c, err = issueLeaf(ca, name); err != nil {
+				return nil, err
+			}
+		}
+		certLRU.Add(name, c)
+		return c, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*tls.Certificate), nil
+}
+
+// Prewarm 在后台为 hosts 预先签发证书，减少首次握手延迟
+func Prewarm(hosts []string) {
+	if len(hosts) == 0 {
+		return
+	}
+	go func() {
+		start := time.Now()
+		for _, h := range hosts {
+			if _, err := getHostCert(h); err != nil {
+				logx.D("[mitm] prewarm %s: %v", h, err)
+			}
+		}
+		logx.D("[mitm] prewarmed %d host cert(s) in %s", len(hosts), time.Since(start).Round(time.Millisecond))
+	}()
+}
 
-	if cp, ok := certLRU.Get(host); ok {
-		return cp, nil
+// certName 返回证书的名字（也是 LRU / 磁盘缓存的 key）：
+// 开启 Wildcard 时 a.example.com → *.example.com；IP、单标签域名与公共后缀下一级保持原样
+func certName(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if !opts.Wildcard || net.ParseIP(host) != nil {
+		return host
+	}
+	_, parent, ok := strings.Cut(host, ".")
+	if !ok {
+		return host
 	}
+	// 通配符不能覆盖公共后缀（*.com、*.co.uk），parent 至少要是 eTLD+1
+	if _, err := publicsuffix.EffectiveTLDPlusOne(parent); err != nil {
+		return host
+	}
+	return "*." + parent
+}
 
-	key, _ := rsa.GenerateKey(rand.Reader, rsaBitsHost)
+func issueLeaf(ca *CA, host string) (*tls.Certificate, error) {
+	var (
+		key   crypto.Signer
+		err   error
+		usage = x509.KeyUsageDigitalSignature
+	)
+	if opts.LeafKey == "rsa" {
+		key, err = rsa.GenerateKey(rand.Reader, rsaBitsHost)
+		usage |= x509.KeyUsageKeyEncipherment
+	} else {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
 	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
 
 	tmpl := &x509.Certificate{
@@ -60,78 +161,99 @@ func getHostCert(host string) (tlsCertPair, error) {
 		Subject:      pkix.Name{CommonName: host},
 		NotBefore:    time.Now().Add(-30 * time.Minute),
 		NotAfter:     time.Now().AddDate(hostYears, 0, 0),
-		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		KeyUsage:     usage,
 		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		DNSNames:     []string{host},
+	}
+	switch ip := net.ParseIP(host); {
+	case ip != nil: // IP 直连（CONNECT 10.0.0.5:443）需要 IP SAN
+		tmpl.IPAddresses = []net.IP{ip}
+	case strings.HasPrefix(host, "*."): // 通配符不覆盖父域名本身，一并加上
+		tmpl.DNSNames = []string{host, host[2:]}
+	default:
+		tmpl.DNSNames = []string{host}
 	}
 
-	der, err := x509.CreateCertificate(rand.Reader, tmpl, rootCert, &key.PublicKey, rootKey)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, key.Public(), ca.Key)
 	if err != nil {
-		return tlsCertPair{}, err
+		return nil, err
 	}
-
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
-
-	pair := tlsCertPair{CertPEM: certPEM, KeyPEM: keyPEM}
-	certLRU.Add(host, pair)
-	return pair, nil
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	c := &tls.Certificate{Certificate: append([][]byte{der}, ca.Chain...), PrivateKey: key, Leaf: leaf}
+	if opts.Persist {
+		if err := saveLeaf(host, c); err != nil {
+			logx.D("[mitm] save cert %s: %v", host, err)
+		}
+	}
+	return c, nil
 }
 
 /* ----------------------------------------------------
- *  Root CA (create once, persist $HOME/go-whistle-lite)
+ *  On-disk leaf cache: ~/go-whistle-lite/certs/<host>.pem
  * --------------------------------------------------*/
-func initRootCA() {
-	dir := filepath.Join(os.Getenv("HOME"), "go-whistle-lite")
-	_ = os.MkdirAll(dir, 0700)
-	certPath := filepath.Join(dir, "rootCA.pem")
-	keyPath := filepath.Join(dir, "rootCA.key")
-
-	// load if exists
-	cBytes, cErr := os.ReadFile(certPath)
-	kBytes, kErr := os.ReadFile(keyPath)
-	if cErr == nil && kErr == nil {
-		block, _ := pem.Decode(cBytes)
-		rootCert, _ = x509.ParseCertificate(block.Bytes)
-		block, _ = pem.Decode(kBytes)
-		rootKey, _ = x509.ParsePKCS1PrivateKey(block.Bytes)
-		log.Printf("[mitm] loaded root CA %s", certPath)
-		return
-	}
 
-	// else generate new root
-	var err error
-	rootKey, err = rsa.GenerateKey(rand.Reader, rsaBitsRoot)
+func leafPath(host string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, host)
+	return filepath.Join(leafDir(), name+".pem")
+}
+
+func leafDir() string { return filepath.Join(dataDir(), "certs") }
+
+func saveLeaf(host string, c *tls.Certificate) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(c.PrivateKey)
 	if err != nil {
-		log.Fatalf("generate root key: %v", err)
+		return err
 	}
-
-	rootSerial, _ := rand.Int(rand.Reader, big.NewInt(1<<61))
-	rootCert = &x509.Certificate{
-		SerialNumber: rootSerial,
-		Subject: pkix.Name{
-			Organization:       []string{"go-whistle-lite"},
-			OrganizationalUnit: []string{"Proxy MITM"},
-			CommonName:         "go-whistle-lite Root CA",
-		},
-		NotBefore:  time.Now().Add(-1 * time.Hour),
-		NotAfter:   time.Now().AddDate(rootYears, 0, 0),
-		KeyUsage:   x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
-		IsCA:       true,
-		MaxPathLen: 0,
+	p := leafPath(host)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
 	}
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Certificate[0]})
+	b = append(b, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+	return os.WriteFile(p, b, 0600)
+}
 
-	der, err := x509.CreateCertificate(rand.Reader, rootCert, rootCert, &rootKey.PublicKey, rootKey)
+// loadLeaf 读取磁盘缓存；过期、换了 CA、换了 key 类型或不再覆盖该名字时视为未命中
+func loadLeaf(ca *CA, host string) (*tls.Certificate, error) {
+	if !opts.Persist {
+		return nil, os.ErrNotExist
+	}
+	b, err := os.ReadFile(leafPath(host))
 	if err != nil {
-		log.Fatalf("create root cert: %v", err)
+		return nil, err
 	}
-
-	cBytes = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
-	kBytes = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rootKey)})
-
-	_ = os.WriteFile(certPath, cBytes, 0600)
-	_ = os.WriteFile(keyPath, kBytes, 0600)
-	log.Printf("[mitm] generated new root CA %s", certPath)
-
-	fmt.Println("\n⚠️  Import the following RootCA into your system/ browser trust store:\n", certPath)
+	c, err := tls.X509KeyPair(b, b)
+	if err != nil {
+		return nil, err
+	}
+	leaf := c.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+			return nil, err
+		}
+		c.Leaf = leaf
+	}
+	wantAlg := x509.ECDSA
+	if opts.LeafKey == "rsa" {
+		wantAlg = x509.RSA
+	}
+	switch {
+	case time.Until(leaf.NotAfter) < 24*time.Hour:
+		return nil, fmt.Errorf("expired")
+	case leaf.PublicKeyAlgorithm != wantAlg:
+		return nil, fmt.Errorf("key type changed")
+	case ca.Cert.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature) != nil:
+		return nil, fmt.Errorf("issued by another CA")
+	case leaf.VerifyHostname(strings.TrimPrefix(host, "*.")) != nil:
+		return nil, fmt.Errorf("does not cover %s", host)
+	}
+	c.Certificate = append(c.Certificate[:1], ca.Chain...)
+	return &c, nil
 }
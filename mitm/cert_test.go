@@ -0,0 +1,161 @@
+package mitm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCA(t *testing.T, cn string) *CA {
+	t.Helper()
+	cert, key, _, _ := writeCA(t, &x509.Certificate{Subject: pkix.Name{CommonName: cn}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil, nil)
+	ca, err := LoadCA(cert, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+// withOpts 在测试期间替换全局 opts，并把叶子证书缓存放到临时 HOME
+func withOpts(t *testing.T, o Options) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SUDO_USER", "") // dataDir 跟随 InvokingHome，sudo 下会改用调用者的 home
+	saved := opts
+	t.Cleanup(func() { opts = saved })
+	opts = o
+}
+
+func TestLoadLeafInvalidation(t *testing.T) {
+	withOpts(t, Options{LeafKey: "ecdsa", Persist: true})
+	ca, other := testCA(t, "ca"), testCA(t, "other")
+	const host = "a.example.com"
+	if _, err := issueLeaf(ca, host); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadLeaf(ca, host)
+	if err != nil {
+		t.Fatalf("fresh leaf: %v", err)
+	}
+	if c.Leaf == nil || c.Leaf.Subject.CommonName != host || len(c.Certificate) != 1+len(ca.Chain) {
+		t.Errorf("loaded leaf = %v, %d cert(s)", c.Leaf.Subject, len(c.Certificate))
+	}
+
+	if _, err := loadLeaf(other, host); err == nil || !strings.Contains(err.Error(), "another CA") {
+		t.Errorf("other CA: %v", err)
+	}
+
+	opts.LeafKey = "rsa"
+	if _, err := loadLeaf(ca, host); err == nil || !strings.Contains(err.Error(), "key type") {
+		t.Errorf("key type changed: %v", err)
+	}
+	opts.LeafKey = "ecdsa"
+
+	// 文件名换成别的 host：证书不覆盖它
+	b, _ := os.ReadFile(leafPath(host))
+	os.WriteFile(leafPath("b.example.com"), b, 0o600)
+	if _, err := loadLeaf(ca, "b.example.com"); err == nil || !strings.Contains(err.Error(), "does not cover") {
+		t.Errorf("other host: %v", err)
+	}
+
+	// 即将过期
+	saveLeaf("soon.example.com", expiringLeaf(t, ca, "soon.example.com"))
+	if _, err := loadLeaf(ca, "soon.example.com"); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expiring leaf: %v", err)
+	}
+
+	if _, err := loadLeaf(ca, "missing.example.com"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing leaf: %v", err)
+	}
+	opts.Persist = false
+	if _, err := loadLeaf(ca, host); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("persist off: %v", err)
+	}
+}
+
+func expiringLeaf(t *testing.T, ca *CA, host string) *tls.Certificate {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, &key.PublicKey, ca.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCertName(t *testing.T) {
+	cases := []struct {
+		host          string
+		plain, shared string // Wildcard 关 / 开
+	}{
+		{"a.example.com", "a.example.com", "*.example.com"},
+		{"A.Example.COM.", "a.example.com", "*.example.com"},
+		{"x.y.example.com", "x.y.example.com", "*.y.example.com"},
+		{"example.com", "example.com", "example.com"}, // 不能是 *.com
+		{"a.example.co.uk", "a.example.co.uk", "*.example.co.uk"},
+		{"example.co.uk", "example.co.uk", "example.co.uk"}, // 不能是 *.co.uk
+		{"a.github.io", "a.github.io", "a.github.io"},       // github.io 是公共后缀
+		{"localhost", "localhost", "localhost"},
+		{"10.0.0.5", "10.0.0.5", "10.0.0.5"},
+		{"::1", "::1", "::1"},
+	}
+	withOpts(t, Options{LeafKey: "ecdsa"})
+	for _, c := range cases {
+		opts.Wildcard = false
+		if got := certName(c.host); got != c.plain {
+			t.Errorf("certName(%q) = %q, want %q", c.host, got, c.plain)
+		}
+		opts.Wildcard = true
+		if got := certName(c.host); got != c.shared {
+			t.Errorf("wildcard certName(%q) = %q, want %q", c.host, got, c.shared)
+		}
+	}
+}
+
+func TestIssueLeafNames(t *testing.T) {
+	withOpts(t, Options{LeafKey: "ecdsa"})
+	ca := testCA(t, "ca")
+	cases := []struct {
+		name  string
+		hosts []string // 应当通过 VerifyHostname 的名字
+		not   []string
+	}{
+		{"a.example.com", []string{"a.example.com"}, []string{"b.example.com"}},
+		{"*.example.com", []string{"a.example.com", "example.com"}, []string{"x.a.example.com"}},
+		{"10.0.0.5", []string{"10.0.0.5"}, []string{"10.0.0.6"}},
+		{"::1", []string{"::1"}, nil},
+	}
+	for _, c := range cases {
+		tc, err := issueLeaf(ca, c.name)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		for _, h := range c.hosts {
+			if err := tc.Leaf.VerifyHostname(h); err != nil {
+				t.Errorf("%s: %v", c.name, err)
+			}
+		}
+		for _, h := range c.not {
+			if tc.Leaf.VerifyHostname(h) == nil {
+				t.Errorf("%s unexpectedly covers %s", c.name, h)
+			}
+		}
+	}
+}
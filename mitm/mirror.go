@@ -0,0 +1,136 @@
+package mitm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net"
+	"slices"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+	"github.com/sonacy/go-whistle-lite/transport"
+)
+
+/* ----------------------------------------------------
+ *  -mirror-certs：先连上游，按真实证书伪造叶子证书，
+ *  并且只向客户端提供上游实际协商出的 ALPN
+ * --------------------------------------------------*/
+
+// 以上游证书指纹为 key，上游换证书后自然重新签发
+var mirrorLRU, _ = lru.New[string, *tls.Certificate](1000)
+
+// mirrorConfig 在拿到 ClientHello 后探测上游；失败时返回 nil，沿用普通叶子证书
+func mirrorConfig(addr, host string) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		sni := hello.ServerName
+		if sni == "" {
+			sni = host
+		}
+		up, err := probe(addr, sni, hello.SupportedProtos)
+		if err != nil {
+			logx.D("[mitm] mirror %s: %v (using a plain leaf)", addr, err)
+			return nil, nil
+		}
+		cert, err := mirrorCert(up.PeerCertificates[0])
+		if err != nil {
+			logx.D("[mitm] mirror %s: %v", addr, err)
+			return nil, nil
+		}
+		var protos []string
+		if up.NegotiatedProtocol != "" {
+			protos = []string{up.NegotiatedProtocol}
+		}
+		logx.D("[mitm] mirror %s: %s, alpn %q", addr, cert.Leaf.Subject, up.NegotiatedProtocol)
+		return &tls.Config{Certificates: []tls.Certificate{*cert}, NextProtos: protos, KeyLogWriter: transport.KeyLog()}, nil
+	}
+}
+
+// probe 以客户端提供的 ALPN（只保留 -downstream-proto 允许的）与上游握手，取得证书与协商结果
+func probe(addr, sni string, offered []string) (*tls.ConnectionState, error) {
+	c := transport.TLSConfig(sni)
+	for _, p := range offered {
+		if slices.Contains(downstreamProtos(), p) {
+			c.NextProtos = append(c.NextProtos, p)
+		}
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", addr, c)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	st := conn.ConnectionState()
+	if len(st.PeerCertificates) == 0 {
+		return nil, errNoPeerCert
+	}
+	return &st, nil
+}
+
+var errNoPeerCert = errors.New("upstream sent no certificate")
+
+// mirrorCert 复制上游证书的 subject、SAN、有效期与用途，用我们的 CA 重新签发
+func mirrorCert(up *x509.Certificate) (*tls.Certificate, error) {
+	sum := sha256.Sum256(up.Raw)
+	key := hex.EncodeToString(sum[:])
+	if c, ok := mirrorLRU.Get(key); ok {
+		return c, nil
+	}
+	v, err, _ := issuing.Do("mirror:"+key, func() (any, error) {
+		ca, err := currentCA()
+		if err != nil {
+			return nil, err
+		}
+		var priv crypto.Signer
+		usage := up.KeyUsage
+		if opts.LeafKey == "rsa" {
+			priv, err = rsa.GenerateKey(rand.Reader, rsaBitsHost)
+		} else {
+			priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			usage &^= x509.KeyUsageKeyEncipherment // EC 密钥不能用于密钥加密（RFC 5480）
+		}
+		if err != nil {
+			return nil, err
+		}
+		serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+		tmpl := &x509.Certificate{
+			SerialNumber:   serial,
+			RawSubject:     up.RawSubject, // 原样复制，保留 pkix.Name 不认识的属性
+			NotBefore:      up.NotBefore,
+			NotAfter:       up.NotAfter,
+			KeyUsage:       usage,
+			ExtKeyUsage:    up.ExtKeyUsage,
+			DNSNames:       up.DNSNames,
+			IPAddresses:    up.IPAddresses,
+			URIs:           up.URIs,
+			EmailAddresses: up.EmailAddresses,
+		}
+		if tmpl.NotAfter.After(ca.Cert.NotAfter) { // 不超过 CA 的有效期
+			tmpl.NotAfter = ca.Cert.NotAfter
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, priv.Public(), ca.Key)
+		if err != nil {
+			return nil, err
+		}
+		leaf, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		c := &tls.Certificate{Certificate: append([][]byte{der}, ca.Chain...), PrivateKey: priv, Leaf: leaf}
+		mirrorLRU.Add(key, c)
+		return c, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*tls.Certificate), nil
+}
@@ -3,35 +3,24 @@ package mitm
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
-	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
-	"sync"
-	"time"
 
 	http2 "golang.org/x/net/http2"
 
+	"github.com/sonacy/go-whistle-lite/fault"
+	"github.com/sonacy/go-whistle-lite/grpcx"
 	"github.com/sonacy/go-whistle-lite/internal/logx"
+	"github.com/sonacy/go-whistle-lite/rewrite"
 	"github.com/sonacy/go-whistle-lite/rules"
 	"github.com/sonacy/go-whistle-lite/transport"
 )
 
-var bufPool = sync.Pool{
-	New: func() any { return make([]byte, 32<<10) }, // 32 KB
-}
-
-func copyStream(dst io.Writer, src io.Reader) (int64, error) {
-	buf := bufPool.Get().([]byte)
-	n, err := io.CopyBuffer(dst, src, buf)
-	bufPool.Put(buf)
-	return n, err
-}
-
 /* ------------ CONNECT entry ------------ */
 
 func Intercept(w http.ResponseWriter, r *http.Request) {
@@ -46,38 +35,52 @@ func Intercept(w http.ResponseWriter, r *http.Request) {
 
 	/* 2. gen fake cert & TLS with client */
 	host := extractHost(r.Host)
-	pair, err := getHostCert(host)
+	conf, err := serverConfig(r.Host, host)
 	if err != nil {
 		logx.D("cert: %v", err)
 		cliRaw.Close()
 		return
 	}
-	cert, _ := tls.X509KeyPair(pair.CertPEM, pair.KeyPEM)
 
-	cli := tls.Server(cliRaw, &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		NextProtos:   []string{"h2", "http/1.1"},
-	})
+	cli := tls.Server(cliRaw, conf)
 	if err := cli.Handshake(); err != nil {
 		logx.D("TLS handshake: %v", err)
 		cli.Close()
 		return
 	}
 
-	np := cli.ConnectionState().NegotiatedProtocol
-	if np == "h2" {
+	if cli.ConnectionState().NegotiatedProtocol == "h2" {
 		serveH2(cli)
 		return
 	}
 
-	/* 3. HTTP/1.x path */
-	up, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", r.Host, &tls.Config{InsecureSkipVerify: true})
+	/* 3. HTTP/1.x path：上游连接由 transport 的连接池提供 */
+	pipeHTTP1(cli)
+}
+
+// serverConfig 返回与客户端握手用的配置
+func serverConfig(addr, host string) (*tls.Config, error) {
+	c := &tls.Config{NextProtos: downstreamProtos(), KeyLogWriter: transport.KeyLog()}
+	if opts.Mirror && !IsMagicHost(host) {
+		c.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return getHostCert(host) }
+		c.GetConfigForClient = mirrorConfig(addr, host)
+		return c, nil
+	}
+	cert, err := getHostCert(host)
 	if err != nil {
-		logx.D("dial up: %v", err)
-		cli.Close()
-		return
+		return nil, err
+	}
+	c.Certificates = []tls.Certificate{*cert}
+	return c, nil
+}
+
+// downstreamProtos 按 -downstream-proto 返回向客户端提供的 ALPN。
+// 没有 "h2" only：crypto/tls 会让只说 http/1.1 的客户端照常连上，强制不了
+func downstreamProtos() []string {
+	if opts.Downstream == "h1" {
+		return []string{"http/1.1"}
 	}
-	pipeHTTP1(cli, up)
+	return []string{"h2", "http/1.1"}
 }
 
 /* ------------ HTTP/2 downstream ------------ */
@@ -99,54 +102,85 @@ func h2Handler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Host == "" { // ← 新增：补上 Host
 		r.URL.Host = r.Host
 	}
+	if IsMagicHost(r.Host) {
+		Onboard.ServeHTTP(w, r)
+		return
+	}
 
 	orig := r.URL
-	dst := buildMapRemoteURL(rules.Match(orig), orig)
+	var flt *rules.Fault
+	ru := rules.Match(orig, r.Method, r.Header)
+	dst := buildMapRemoteURL(ru, orig)
 
 	/* request-side rules */
-	if ru := rules.Match(orig); ru != nil {
-		switch ru.Action {
-		case rules.ActStatus:
-			if code, ok := rules.ParseStatus(ru.Param); ok {
-				w.WriteHeader(code)
+	if ru != nil {
+		logx.D("[rule   ] %s ← %s %s", orig, ru.Pos(), ru.Raw)
+		w.Header().Set(rules.TraceHeader, ru.Pos())
+
+		for _, a := range ru.Actions {
+			switch a.Name {
+			case rules.ActStatus:
+				if code, ok := rules.ParseStatus(a.Param); ok {
+					w.WriteHeader(code)
+					return
+				}
+			case rules.ActMapLocal:
+				rewrite.ServeLocal(w, r, ru, a.Param)
 				return
+			case rules.ActRedirect, rules.ActCORS, rules.ActGRPC:
+				if resp := rewrite.LocalResponse(r, a); resp != nil {
+					rewrite.WriteLocal(w, resp)
+					return
+				}
+			case rules.ActFault:
+				if f, ok := fault.Roll(a.Param); ok {
+					if !f.AfterUpstream() {
+						fault.Serve(w, r, f, nil)
+						return
+					}
+					flt = &f
+				}
+			case rules.ActReqHeader:
+				rewrite.ApplyHeader(r.Header, a.Param)
+			case rules.ActAuth:
+				rewrite.ApplyAuth(r.Header, a.Param)
 			}
-		case rules.ActMapLocal:
-			serveLocalHTTP(w, r, ru.Param)
-			return
-		case rules.ActReqHeader:
-			applyHeader(&r.Header, ru.Param)
 		}
 	}
 
-	out, _ := http.NewRequest(r.Method, dst.String(), r.Body)
+	dst = rewrite.URL(dst, ru)
+	out, _ := http.NewRequest(rewrite.Method(r.Method, ru), dst.String(), r.Body)
 	out.Header = r.Header.Clone()
+	rewrite.PrepareRequest(out, ru)
+	grpcx.WatchRequest(out)
 
-	resp, err := transport.Upstream.RoundTrip(out)
+	resp, err := transport.For(ru, r).RoundTrip(out)
 	if err != nil {
-		w.WriteHeader(http.StatusBadGateway)
-		fmt.Fprint(w, err.Error())
+		logx.D("rt: %v", err)
+		rewrite.WriteLocal(w, transport.ErrorResponse(out, err))
 		return
 	}
+	grpcx.WatchResponse(resp)
 	defer resp.Body.Close()
 
-	if ru := rules.Match(orig); ru != nil && ru.Action == rules.ActRespHeader {
-		applyHeader(&resp.Header, ru.Param)
+	for _, p := range ru.Params(rules.ActRespHeader) {
+		rewrite.ApplyHeader(resp.Header, p)
 	}
-
-	for k, v := range resp.Header {
-		w.Header()[k] = v
+	rewrite.Response(resp, ru)
+	if flt != nil {
+		fault.Serve(w, r, *flt, resp)
+		return
 	}
-	w.WriteHeader(resp.StatusCode)
-	copyStream(w, resp.Body)
+
+	rewrite.Forward(w, resp)
 }
 
 /* ------------ HTTP/1.x downstream ------------ */
 
-func pipeHTTP1(cli, up net.Conn) {
+func pipeHTTP1(cli net.Conn) {
 	defer cli.Close()
-	defer up.Close()
 	rd := bufio.NewReader(cli)
+next:
 	for {
 		req, err := http.ReadRequest(rd)
 		if err != nil {
@@ -155,49 +189,112 @@ func pipeHTTP1(cli, up net.Conn) {
 			}
 			return
 		}
+		if IsMagicHost(req.Host) {
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, cli.LocalAddr()))
+			resp := rewrite.Record(req, Onboard)
+			discard(req)
+			resp.Write(cli)
+			continue
+		}
 
 		orig := &url.URL{Scheme: "https", Host: req.Host, Path: req.URL.Path, RawQuery: req.URL.RawQuery}
-		dst := buildMapRemoteURL(rules.Match(orig), orig)
-
-		if ru := rules.Match(orig); ru != nil {
-			switch ru.Action {
-			case rules.ActStatus:
-				if code, ok := rules.ParseStatus(ru.Param); ok {
-					fmt.Fprintf(cli, "HTTP/1.1 %d \r\nContent-Length:0\r\n\r\n", code)
-					continue
+		var flt *rules.Fault
+		ru := rules.Match(orig, req.Method, req.Header)
+		dst := buildMapRemoteURL(ru, orig)
+
+		if ru != nil {
+			logx.D("[rule   ] %s ← %s %s", orig, ru.Pos(), ru.Raw)
+
+			for _, a := range ru.Actions {
+				switch a.Name {
+				case rules.ActStatus:
+					if code, ok := rules.ParseStatus(a.Param); ok {
+						discard(req)
+						resp := rewrite.StatusResponse(req, code)
+						resp.Header.Set(rules.TraceHeader, ru.Pos())
+						resp.Write(cli)
+						continue next
+					}
+				case rules.ActMapLocal:
+					discard(req)
+					resp := rewrite.Local(req, ru, a.Param)
+					resp.Header.Set(rules.TraceHeader, ru.Pos())
+					resp.Write(cli)
+					resp.Body.Close()
+					continue next
+				case rules.ActRedirect, rules.ActCORS, rules.ActGRPC:
+					if resp := rewrite.LocalResponse(req, a); resp != nil {
+						discard(req)
+						resp.Header.Set(rules.TraceHeader, ru.Pos())
+						resp.Write(cli)
+						continue next
+					}
+				case rules.ActFault:
+					if f, ok := fault.Roll(a.Param); ok {
+						if !f.AfterUpstream() {
+							fault.Conn(cli, f, nil)
+							return
+						}
+						flt = &f
+					}
+				case rules.ActReqHeader:
+					rewrite.ApplyHeader(req.Header, a.Param)
+				case rules.ActAuth:
+					rewrite.ApplyAuth(req.Header, a.Param)
 				}
-			case rules.ActMapLocal:
-				serveLocalTLS(cli, ru.Param)
-				continue
-			case rules.ActReqHeader:
-				applyHeader(&req.Header, ru.Param)
 			}
 		}
 
-		out, _ := http.NewRequest(req.Method, dst.String(), req.Body)
+		dst = rewrite.URL(dst, ru)
+		out, _ := http.NewRequest(rewrite.Method(req.Method, ru), dst.String(), req.Body)
 		out.Header = req.Header.Clone()
+		rewrite.PrepareRequest(out, ru)
+		grpcx.WatchRequest(out)
 
-		resp, err := transport.Upstream.RoundTrip(out)
+		resp, err := transport.For(ru, req).RoundTrip(out)
 		if err != nil {
 			logx.D("rt: %v", err)
-			return
+			transport.ErrorResponse(out, err).Write(cli)
+			continue
 		}
+		grpcx.WatchResponse(resp)
 
-		if ru := rules.Match(orig); ru != nil && ru.Action == rules.ActRespHeader {
-			applyHeader(&resp.Header, ru.Param)
+		if ru != nil {
+			resp.Header.Set(rules.TraceHeader, ru.Pos())
+		}
+		for _, p := range ru.Params(rules.ActRespHeader) {
+			rewrite.ApplyHeader(resp.Header, p)
+		}
+		rewrite.Response(resp, ru)
+		if flt != nil {
+			fault.Conn(cli, *flt, resp)
+			resp.Body.Close()
+			return
+		}
+		// 上游可能是 h2 或不带长度的 HTTP/1.0：下游统一按 HTTP/1.1 分块写回，保持连接可复用
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor, resp.Close = "HTTP/1.1", 1, 1, false
+		if resp.ContentLength < 0 && len(resp.TransferEncoding) == 0 {
+			resp.TransferEncoding = []string{"chunked"}
 		}
 		resp.Write(cli)
 		resp.Body.Close()
 	}
 }
 
+// discard 读完并关闭请求 body：本地应答时 body 不会被转发，留在连接里会被当成下一个请求
+func discard(req *http.Request) {
+	io.Copy(io.Discard, req.Body)
+	req.Body.Close()
+}
+
 /* ------------ shared helpers ------------ */
 
 func buildMapRemoteURL(ru *rules.Rule, src *url.URL) *url.URL {
-	if ru == nil || ru.Action != rules.ActMapRemote {
+	a, ok := ru.Find(rules.ActMapRemote)
+	if !ok {
 		return src
 	}
-	newURL := ru.Param
+	newURL := a.Param
 	if strings.HasSuffix(ru.PathRaw, "*") {
 		prefix := strings.TrimSuffix(ru.PathRaw, "*")
 		suffix := strings.TrimPrefix(src.Path, prefix)
@@ -207,37 +304,10 @@ func buildMapRemoteURL(ru *rules.Rule, src *url.URL) *url.URL {
 		newURL += suffix
 	}
 	u, _ := url.Parse(newURL)
-	return u
-}
-
-func serveLocalTLS(c net.Conn, p string) {
-	if strings.HasPrefix(p, "@") {
-		b, _ := os.ReadFile(p[1:])
-		fmt.Fprintf(c, "HTTP/1.1 200 OK\r\nContent-Length:%d\r\n\r\n", len(b))
-		c.Write(b)
-		return
-	}
-	fmt.Fprintf(c, "HTTP/1.1 200 OK\r\nContent-Length:%d\r\n\r\n%s", len(p), p)
-}
-
-func serveLocalHTTP(w http.ResponseWriter, r *http.Request, p string) {
-	if strings.HasPrefix(p, "@") {
-		http.ServeFile(w, r, p[1:])
-		return
-	}
-	w.Write([]byte(p))
-}
-
-func applyHeader(h *http.Header, p string) {
-	op, k, v := rules.ParseHeaderParam(p)
-	switch strings.ToLower(op) {
-	case "add":
-		h.Add(k, v)
-	case "set":
-		h.Set(k, v)
-	case "del", "remove":
-		h.Del(k)
+	if u.RawQuery == "" { // 目标未带 query 时沿用原请求的
+		u.RawQuery = src.RawQuery
 	}
+	return u
 }
 
 func extractHost(hostport string) string {
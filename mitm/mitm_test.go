@@ -0,0 +1,58 @@
+package mitm
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+// TestPipeHTTP1DrainsLocalBody 引导页和本地应答的请求 body 必须读完，否则同一连接上的下一个请求会错位
+func TestPipeHTTP1DrainsLocalBody(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir) // 引导页会加载 CA，别碰真实的 HOME
+	t.Setenv("SUDO_USER", "")
+	local := filepath.Join(dir, "ok.txt")
+	os.WriteFile(local, []byte("ok"), 0o644)
+	rf := filepath.Join(dir, "rules.txt")
+	os.WriteFile(rf, []byte("a.test/upload mapLocal://@"+local+"\na.test/gone status://410\n"), 0o644)
+	rules.SetFile(rf)
+	t.Cleanup(func() { rules.SetFile("") })
+
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go pipeHTTP1(srv)
+
+	go io.WriteString(cli, "POST / HTTP/1.1\r\nHost: "+MagicHost+"\r\nContent-Length: 3\r\n\r\nxyz"+
+		"POST /upload HTTP/1.1\r\nHost: a.test\r\nContent-Length: 11\r\n\r\nhello=world"+
+		"POST /gone HTTP/1.1\r\nHost: a.test\r\nContent-Length: 4\r\n\r\nabcd"+
+		"GET /gone HTTP/1.1\r\nHost: a.test\r\n\r\n")
+
+	rd := bufio.NewReader(cli)
+	for i, want := range []int{0, 200, 410, 410} {
+		resp, err := http.ReadResponse(rd, nil)
+		if err != nil {
+			t.Fatalf("response #%d: %v", i+1, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want == 0 { // 引导页，只要求是完整的响应
+			continue
+		}
+		if resp.StatusCode != want {
+			t.Fatalf("response #%d: status %d (%q), want %d", i+1, resp.StatusCode, b, want)
+		}
+		if want == 410 && (resp.Status != "410 Gone" || resp.Header.Get(rules.TraceHeader) == "") {
+			t.Errorf("response #%d: status %q, trace %q", i+1, resp.Status, resp.Header.Get(rules.TraceHeader))
+		}
+		if want == 200 && strings.TrimSpace(string(b)) != "ok" {
+			t.Errorf("response #%d: body %q, want ok", i+1, b)
+		}
+	}
+}
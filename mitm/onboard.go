@@ -0,0 +1,203 @@
+package mitm
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+/* ----------------------------------------------------
+ *  CA 下载页：经代理访问 http://gw.lite/ca，
+ *  或直接访问代理端口 http://<ip>:<port>/_gw/ca
+ * --------------------------------------------------*/
+
+// MagicHost 由代理自己应答，不会转发到上游
+const MagicHost = "gw.lite"
+
+// IsMagicHost 判断 host[:port] 是否为下载页域名
+func IsMagicHost(hostport string) bool {
+	return strings.EqualFold(extractHost(hostport), MagicHost)
+}
+
+// Onboard 提供下载页、各格式证书与信任检测接口
+var Onboard = http.HandlerFunc(serveOnboard)
+
+func serveOnboard(w http.ResponseWriter, r *http.Request) {
+	ca, err := currentCA()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	root := ca.Root
+	name := "go-whistle-lite-ca"
+
+	switch strings.TrimPrefix(r.URL.Path, "/_gw") {
+	case "/", "/ca":
+		servePage(w, r, ca)
+	case "/ca.pem":
+		download(w, "application/x-pem-file", name+".pem",
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))
+	case "/ca.crt", "/ca.cer":
+		download(w, "application/x-x509-ca-cert", name+r.URL.Path[strings.LastIndexByte(r.URL.Path, '.'):], root.Raw)
+	case "/ca.mobileconfig":
+		download(w, "application/x-apple-aspen-config", name+".mobileconfig", mobileConfig(root.Raw, root.Subject.CommonName))
+	case "/ca/check":
+		// 页面通过 https://gw.lite/ca/check 发起请求：能拿到响应说明客户端信任了代理签发的证书
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"sha256": Fingerprint(root)})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func download(w http.ResponseWriter, ct, file string, b []byte) {
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+file+`"`)
+	w.Write(b)
+}
+
+/* ---------- HTML ---------- */
+
+var pageTmpl = template.Must(template.New("ca").Parse(`<!doctype html>
+<meta charset="utf-8"><meta name="viewport" content="width=device-width,initial-scale=1">
+<title>go-whistle-lite CA</title>
+<style>body{font:15px/1.5 system-ui,sans-serif;max-width:40em;margin:2em auto;padding:0 1em}
+code{word-break:break-all}a.btn{display:inline-block;margin:.2em .4em .2em 0;padding:.4em .8em;border:1px solid #888;border-radius:6px;text-decoration:none}
+#check{padding:.6em;border-radius:6px;background:#eee}</style>
+<h1>go-whistle-lite CA</h1>
+<p id="check">Checking whether this device trusts the CA…</p>
+<p><b>{{.Subject}}</b><br>valid until {{.NotAfter}}<br>SHA-256 <code>{{.SHA256}}</code></p>
+<p><a class="btn" href="ca.pem">PEM</a><a class="btn" href="ca.crt">DER (.crt)</a><a class="btn" href="ca.cer">DER (.cer)</a><a class="btn" href="ca.mobileconfig">iOS profile</a></p>
+<h2>Proxy</h2>
+<p>Set the Wi-Fi HTTP proxy to <b><code>{{.Proxy}}</code></b>, then open <code>http://{{.Magic}}/ca</code> again to install and check the CA.</p>
+{{if .QR}}<p><img alt="QR code of {{.Proxy}}" width="200" height="200" src="data:image/png;base64,{{.QR}}"><br>Scan to open this page on a phone.</p>{{end}}
+<h2>Install</h2>
+<ul>
+<li><b>iOS</b>: download the profile, install it in Settings → General → VPN &amp; Device Management, then enable full trust in Settings → General → About → Certificate Trust Settings.</li>
+<li><b>Android</b>: download the .crt, then Settings → Security → Encryption &amp; credentials → Install a certificate → CA certificate. Apps only trust user CAs if they opt in.</li>
+<li><b>macOS / Windows / Linux</b>: import the PEM into the system trust store and mark it as trusted for SSL.</li>
+</ul>
+<script>
+(function(){
+  var el=document.getElementById("check"), want={{.SHA256}};
+  function show(ok,msg){el.textContent=msg;el.style.background=ok?"#d4f7d4":"#fde0e0"}
+  fetch("https://{{.Magic}}/ca/check",{cache:"no-store"}).then(function(r){return r.json()}).then(function(j){
+    if(j.sha256===want)show(true,"✅ This device trusts the go-whistle-lite CA.");
+    else show(false,"⚠️ HTTPS works, but through a different CA ("+j.sha256.slice(0,11)+"…).");
+  }).catch(function(){
+    show(false,"❌ Not trusted yet (or this browser is not using the proxy).");
+  });
+})();
+</script>
+`))
+
+func servePage(w http.ResponseWriter, r *http.Request, ca *CA) {
+	proxy := proxyAddr(r)
+	data := map[string]any{
+		"Subject":  ca.Root.Subject.String(),
+		"NotAfter": ca.Root.NotAfter.Format("2006-01-02"),
+		"SHA256":   Fingerprint(ca.Root),
+		"Proxy":    proxy,
+		"Magic":    MagicHost,
+	}
+	if proxy != "" {
+		if png, err := qrcode.Encode("http://"+proxy+"/_gw/ca", qrcode.Medium, 256); err == nil {
+			data["QR"] = base64.StdEncoding.EncodeToString(png)
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = pageTmpl.Execute(w, data)
+}
+
+// proxyAddr 取客户端连入的本地地址；回环地址换成局域网 IP，方便手机扫码
+func proxyAddr(r *http.Request) string {
+	la, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(la.String())
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+		if lan := lanIP(); lan != "" {
+			host = lan
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func lanIP() string {
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.To4() != nil && !n.IP.IsLoopback() && !n.IP.IsLinkLocalUnicast() {
+			return n.IP.String()
+		}
+	}
+	return ""
+}
+
+/* ---------- iOS 描述文件 ---------- */
+
+func mobileConfig(der []byte, cn string) []byte {
+	sum := sha256.Sum256(der)
+	id := func(salt byte) string { // 同一证书的 UUID 固定，重复安装会覆盖旧描述文件
+		b := sum
+		b[0] ^= salt
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+	}
+	esc := template.HTMLEscapeString
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadContent</key>
+	<array>
+		<dict>
+			<key>PayloadCertificateFileName</key>
+			<string>go-whistle-lite-ca.cer</string>
+			<key>PayloadContent</key>
+			<data>` + base64.StdEncoding.EncodeToString(der) + `</data>
+			<key>PayloadDescription</key>
+			<string>Adds the go-whistle-lite root certificate</string>
+			<key>PayloadDisplayName</key>
+			<string>` + esc(cn) + `</string>
+			<key>PayloadIdentifier</key>
+			<string>com.apple.security.root.` + id(1) + `</string>
+			<key>PayloadType</key>
+			<string>com.apple.security.root</string>
+			<key>PayloadUUID</key>
+			<string>` + id(1) + `</string>
+			<key>PayloadVersion</key>
+			<integer>1</integer>
+		</dict>
+	</array>
+	<key>PayloadDisplayName</key>
+	<string>go-whistle-lite CA</string>
+	<key>PayloadIdentifier</key>
+	<string>lite.gw.ca.` + id(2) + `</string>
+	<key>PayloadRemovalDisallowed</key>
+	<false/>
+	<key>PayloadType</key>
+	<string>Configuration</string>
+	<key>PayloadUUID</key>
+	<string>` + id(2) + `</string>
+	<key>PayloadVersion</key>
+	<integer>1</integer>
+</dict>
+</plist>
+`)
+}
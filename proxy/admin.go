@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sonacy/go-whistle-lite/mitm"
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ---------- 内置管理接口：直接请求代理端口（非代理请求）时生效 ---------- */
+
+var admin = http.NewServeMux()
+
+func init() {
+	admin.HandleFunc("/_gw/explain", serveExplain)
+	admin.HandleFunc("/_gw/stats", serveStats)
+	admin.Handle("/_gw/", mitm.Onboard) // /_gw/ca 证书下载页（未设代理的手机扫码访问）
+}
+
+// serveExplain: GET /_gw/explain?url=https://a.com/x&method=POST&h=Key:Value
+func serveExplain(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	u, err := url.Parse(q.Get("url"))
+	if err != nil || !u.IsAbs() {
+		http.Error(w, "query param url must be an absolute URL", http.StatusBadRequest)
+		return
+	}
+	method := q.Get("method")
+	if method == "" {
+		method = http.MethodGet
+	}
+	h := http.Header{}
+	for _, kv := range q["h"] {
+		if k, v, ok := strings.Cut(kv, ":"); ok {
+			h.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+		}
+	}
+	writeJSON(w, rules.Explain(u, strings.ToUpper(method), h))
+}
+
+// serveStats: GET /_gw/stats[?dead=1] — 每条规则的命中次数 / 最近命中时间
+func serveStats(w http.ResponseWriter, r *http.Request) {
+	ss := rules.Stats()
+	if r.URL.Query().Get("dead") == "1" {
+		dead := ss[:0]
+		for _, s := range ss {
+			if s.Hits == 0 {
+				dead = append(dead, s)
+			}
+		}
+		ss = dead
+	}
+	writeJSON(w, ss)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
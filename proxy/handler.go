@@ -1,27 +1,61 @@
 package proxy
 
 import (
-	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
-	"sync"
 
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/sonacy/go-whistle-lite/fault"
+	"github.com/sonacy/go-whistle-lite/grpcx"
 	"github.com/sonacy/go-whistle-lite/internal/logx"
 	"github.com/sonacy/go-whistle-lite/mitm"
+	"github.com/sonacy/go-whistle-lite/rewrite"
 	"github.com/sonacy/go-whistle-lite/rules"
 	"github.com/sonacy/go-whistle-lite/transport"
 )
 
-var bufPool = sync.Pool{
-	New: func() any { return make([]byte, 32<<10) }, // 32 KB
+// Handler 是代理端口的入口：同端口额外接受 h2c（prior-knowledge 与直连时的 Upgrade）
+func Handler() http.Handler {
+	h := h2c.NewHandler(http.HandlerFunc(HandleRequest), &http2.Server{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.IsAbs() && httpguts.HeaderValuesContainsToken(r.Header["Upgrade"], "h2c") {
+			// 代理形式的请求不做升级（客户端收到 101 也不会切换），去掉 h2c 相关的逐跳头按 HTTP/1.1 转发
+			stripH2C(r.Header)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// stripH2C 去掉 Upgrade 中的 h2c 与 HTTP2-Settings，其余升级（如 websocket）保留
+func stripH2C(h http.Header) {
+	dropToken(h, "Upgrade", "h2c")
+	dropToken(h, "Connection", "HTTP2-Settings")
+	if len(h["Upgrade"]) == 0 {
+		dropToken(h, "Connection", "Upgrade")
+	}
+	h.Del("HTTP2-Settings")
 }
 
-func copyStream(dst io.Writer, src io.Reader) (int64, error) {
-	buf := bufPool.Get().([]byte)
-	n, err := io.CopyBuffer(dst, src, buf)
-	bufPool.Put(buf)
-	return n, err
+// dropToken 从逗号分隔的头中去掉 token（不区分大小写），剩余为空时删除整个头
+func dropToken(h http.Header, key, token string) {
+	var keep []string
+	for _, v := range h[key] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" && !strings.EqualFold(t, token) {
+				keep = append(keep, t)
+			}
+		}
+	}
+	if len(keep) == 0 {
+		h.Del(key)
+		return
+	}
+	h[key] = []string{strings.Join(keep, ", ")}
 }
 
 func HandleRequest(w http.ResponseWriter, r *http.Request) {
@@ -30,61 +64,121 @@ func HandleRequest(w http.ResponseWriter, r *http.Request) {
 		mitm.Intercept(w, r)
 		return
 	}
+	if r.ProtoMajor == 2 && !r.URL.IsAbs() && !isSelf(r) {
+		// h2c 没有 absolute-form：:authority 指向别的主机即视为代理请求
+		r.URL.Scheme, r.URL.Host = "http", r.Host
+	}
+	if !r.URL.IsAbs() { // 直接访问代理端口 → 内置管理接口
+		admin.ServeHTTP(w, r)
+		return
+	}
+	if mitm.IsMagicHost(r.Host) { // http://gw.lite/ca 证书下载页
+		mitm.Onboard.ServeHTTP(w, r)
+		return
+	}
 	logx.D("[HTTP   ] %s %s", r.Method, r.URL.String())
 	handleHTTP(w, r)
 }
 
+// isSelf 判断 Host 是否就是代理监听的地址（本机 / 回环 + 同端口）
+func isSelf(r *http.Request) bool {
+	la, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return false
+	}
+	lhost, lport, _ := net.SplitHostPort(la.String())
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil || port != lport {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return host == "localhost" || ip != nil && (ip.IsLoopback() || ip.Equal(net.ParseIP(lhost)))
+}
+
 func handleHTTP(w http.ResponseWriter, r *http.Request) {
 	target := r.URL
-	if ru := rules.Match(r.URL); ru != nil {
-		switch ru.Action {
-
-		case rules.ActMapRemote:
-			target = buildMapRemoteURL(ru, r.URL)
-
-		case rules.ActStatus:
-			if code, ok := rules.ParseStatus(ru.Param); ok {
-				w.WriteHeader(code)
+	var flt *rules.Fault // 需要上游响应的故障（truncate / badchunk）
+	ru := rules.Match(r.URL, r.Method, r.Header)
+	if ru != nil {
+		logx.D("[rule   ] %s ← %s %s", r.URL, ru.Pos(), ru.Raw)
+		w.Header().Set(rules.TraceHeader, ru.Pos())
+
+		for _, a := range ru.Actions {
+			switch a.Name {
+
+			case rules.ActMapRemote:
+				target = buildMapRemoteURL(ru, a.Param, r.URL)
+
+			case rules.ActStatus:
+				if code, ok := rules.ParseStatus(a.Param); ok {
+					w.WriteHeader(code)
+					return
+				}
+
+			case rules.ActMapLocal:
+				rewrite.ServeLocal(w, r, ru, a.Param)
 				return
-			}
 
-		case rules.ActMapLocal:
-			serveLocal(w, r, ru.Param)
-			return
-
-		case rules.ActReqHeader:
-			applyHeader(&r.Header, ru.Param)
+			case rules.ActRedirect, rules.ActCORS, rules.ActGRPC:
+				if resp := rewrite.LocalResponse(r, a); resp != nil {
+					rewrite.WriteLocal(w, resp)
+					return
+				}
+
+			case rules.ActFault:
+				if f, ok := fault.Roll(a.Param); ok {
+					if !f.AfterUpstream() {
+						fault.Serve(w, r, f, nil)
+						return
+					}
+					flt = &f
+				}
+
+			case rules.ActReqHeader:
+				rewrite.ApplyHeader(r.Header, a.Param)
+
+			case rules.ActAuth:
+				rewrite.ApplyAuth(r.Header, a.Param)
+			}
 		}
 	}
 
-	req, _ := http.NewRequest(r.Method, target.String(), r.Body)
+	target = rewrite.URL(target, ru)
+	body := r.Body
+	if r.ProtoMajor == 2 && r.ContentLength == 0 { // h2c 无 body 的请求同 H1 一样用 NoBody，上游回落时可重发
+		body = http.NoBody
+	}
+	req, _ := http.NewRequest(rewrite.Method(r.Method, ru), target.String(), body)
 	req.Header = r.Header.Clone()
+	rewrite.PrepareRequest(req, ru)
+	grpcx.WatchRequest(req)
 
-	resp, err := transport.Upstream.RoundTrip(req)
+	resp, err := transport.For(ru, r).RoundTrip(req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		logx.D("[resp   ] %s: %v", target, err)
+		rewrite.WriteLocal(w, transport.ErrorResponse(req, err))
 		return
 	}
+	grpcx.WatchResponse(resp)
 	defer resp.Body.Close()
 
-	if ru := rules.Match(r.URL); ru != nil && ru.Action == rules.ActRespHeader {
-		applyHeader(&resp.Header, ru.Param)
+	for _, p := range ru.Params(rules.ActRespHeader) {
+		rewrite.ApplyHeader(resp.Header, p)
 	}
-
-	for k, v := range resp.Header {
-		w.Header()[k] = v
+	rewrite.Response(resp, ru)
+	if flt != nil {
+		fault.Serve(w, r, *flt, resp)
+		return
 	}
-	w.WriteHeader(resp.StatusCode)
-	copyStream(w, resp.Body)
+
+	rewrite.Forward(w, resp)
 
 	logx.D("[resp   ] %s %d", target, resp.StatusCode)
 }
 
 /* ---------- helpers ---------- */
 
-func buildMapRemoteURL(rule *rules.Rule, src *url.URL) *url.URL {
-	newURL := rule.Param
-
+func buildMapRemoteURL(rule *rules.Rule, newURL string, src *url.URL) *url.URL {
 	// PathRaw 以 '*' 结尾 ⇒ 拼接后缀
 	if strings.HasSuffix(rule.PathRaw, "*") {
 		prefix := strings.TrimSuffix(rule.PathRaw, "*")
@@ -96,25 +190,8 @@ func buildMapRemoteURL(rule *rules.Rule, src *url.URL) *url.URL {
 		newURL += suffix
 	}
 	u, _ := url.Parse(newURL)
-	return u
-}
-
-func serveLocal(w http.ResponseWriter, r *http.Request, p string) {
-	if strings.HasPrefix(p, "@") {
-		http.ServeFile(w, r, p[1:])
-		return
-	}
-	w.Write([]byte(p))
-}
-
-func applyHeader(h *http.Header, p string) {
-	op, k, v := rules.ParseHeaderParam(p)
-	switch strings.ToLower(op) {
-	case "add":
-		h.Add(k, v)
-	case "set":
-		h.Set(k, v)
-	case "del", "remove":
-		h.Del(k)
+	if u.RawQuery == "" { // 目标未带 query 时沿用原请求的
+		u.RawQuery = src.RawQuery
 	}
+	return u
 }
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestStripH2C(t *testing.T) {
+	cases := []struct {
+		name string
+		in   http.Header
+		want http.Header
+	}{
+		{
+			"h2c only",
+			http.Header{"Upgrade": {"h2c"}, "Connection": {"Upgrade, HTTP2-Settings"}, "Http2-Settings": {"AAMAAABkAAQAoAAAAAIAAAAA"}, "Accept": {"*/*"}},
+			http.Header{"Accept": {"*/*"}},
+		},
+		{
+			"websocket kept",
+			http.Header{"Upgrade": {"websocket, h2c"}, "Connection": {"keep-alive, Upgrade, HTTP2-Settings"}, "Http2-Settings": {"x"}},
+			http.Header{"Upgrade": {"websocket"}, "Connection": {"keep-alive, Upgrade"}},
+		},
+		{
+			"split header lines, mixed case",
+			http.Header{"Upgrade": {"H2C", "foo/1"}, "Connection": {"upgrade", "http2-settings"}},
+			http.Header{"Upgrade": {"foo/1"}, "Connection": {"upgrade"}},
+		},
+	}
+	for _, c := range cases {
+		stripH2C(c.in)
+		if !reflect.DeepEqual(c.in, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, c.in, c.want)
+		}
+	}
+}
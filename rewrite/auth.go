@@ -0,0 +1,89 @@
+package rewrite
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ---------- auth://basic:… / bearer:… / strip ---------- */
+
+// ApplyAuth 设置或去掉 Authorization，走与 reqHeader 相同的 ApplyHeader
+func ApplyAuth(h http.Header, p string) {
+	scheme, cred, err := rules.ParseAuth(p)
+	if err != nil {
+		logx.D("[auth   ] %v", err)
+		return
+	}
+	if scheme == "strip" {
+		ApplyHeader(h, "Del:Authorization")
+		ApplyHeader(h, "Del:Proxy-Authorization")
+		return
+	}
+	v, err := credential(cred)
+	if err != nil {
+		logx.D("[auth   ] %s: %v", scheme, err) // 不打印凭据本身
+		return
+	}
+	if scheme == "basic" {
+		v = "Basic " + base64.StdEncoding.EncodeToString([]byte(v))
+	} else {
+		v = "Bearer " + v
+	}
+	ApplyHeader(h, "Set:Authorization="+v)
+}
+
+// credential 解析内联值 / $ENV / @file
+func credential(cred string) (string, error) {
+	switch {
+	case strings.HasPrefix(cred, "$"):
+		v := os.Getenv(cred[1:])
+		if v == "" {
+			return "", fmt.Errorf("env %s is empty", cred[1:])
+		}
+		return v, nil
+	case strings.HasPrefix(cred, "@"):
+		return tokenFile(cred[1:])
+	}
+	return cred, nil
+}
+
+/* ---------- token 文件：按 mtime / size 缓存，变更后重新读取 ---------- */
+
+type tokenEntry struct {
+	mod  time.Time
+	size int64
+	val  string
+}
+
+var tokens sync.Map // path → tokenEntry
+
+func tokenFile(p string) (string, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	if e, ok := tokens.Load(p); ok {
+		if e := e.(tokenEntry); e.mod.Equal(fi.ModTime()) && e.size == fi.Size() {
+			return e.val, nil
+		}
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimSpace(string(b))
+	if v == "" {
+		return "", fmt.Errorf("%s is empty", p)
+	}
+	tokens.Store(p, tokenEntry{fi.ModTime(), fi.Size(), v})
+	logx.D("[auth   ] loaded token file %s", p)
+	return v, nil
+}
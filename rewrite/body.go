@@ -0,0 +1,221 @@
+// Package rewrite 实现改写请求 / 响应 body 的动作，HTTP 与 MITM 两条链路共用
+package rewrite
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// maxBody 限制读入内存改写的 body 大小，超出则原样透传
+const maxBody = 32 << 20
+
+/* ---------- read / decode / encode ---------- */
+
+// readAll 读出整个 body；超过 maxBody 时返回 ok=false 以及可继续透传的 body
+func readAll(rc io.ReadCloser) (b []byte, rest io.ReadCloser, ok bool, err error) {
+	b, err = io.ReadAll(io.LimitReader(rc, maxBody+1))
+	if err != nil {
+		rc.Close()
+		return nil, nil, false, err
+	}
+	if len(b) > maxBody {
+		return nil, struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b), rc), rc}, false, nil
+	}
+	rc.Close()
+	return b, nil, true, nil
+}
+
+func encoding(h http.Header) string {
+	enc := strings.ToLower(strings.TrimSpace(h.Get("Content-Encoding")))
+	if enc == "identity" {
+		return ""
+	}
+	return enc
+}
+
+// decode 按 Content-Encoding 解压
+func decode(raw []byte, enc string) ([]byte, error) {
+	var r io.Reader
+	switch enc {
+	case "":
+		return raw, nil
+	case "gzip", "x-gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		r = gr
+	case "deflate":
+		// 规范是 zlib 包装，部分服务端发裸 deflate
+		if zr, err := zlib.NewReader(bytes.NewReader(raw)); err == nil {
+			r = zr
+		} else {
+			r = flate.NewReader(bytes.NewReader(raw))
+		}
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(raw))
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", enc)
+	}
+	return io.ReadAll(r)
+}
+
+// encode 按原编码重新压缩
+func encode(b []byte, enc string) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch enc {
+	case "":
+		return b, nil
+	case "gzip", "x-gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", enc)
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// limitAcceptEncoding 只保留能解码再编码的格式，保证上游不会返回无法改写的 body
+func limitAcceptEncoding(h http.Header) {
+	ae := h.Get("Accept-Encoding")
+	if ae == "" {
+		return
+	}
+	var keep []string
+	for _, tok := range strings.Split(ae, ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(tok), ";")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "gzip", "x-gzip", "deflate", "br", "identity":
+			keep = append(keep, strings.TrimSpace(tok))
+		}
+	}
+	if len(keep) == 0 {
+		h.Del("Accept-Encoding")
+		return
+	}
+	h.Set("Accept-Encoding", strings.Join(keep, ", "))
+}
+
+// setRespBody 写回改写后的 body 并修正长度相关的 header（chunked → Content-Length）；
+// 上游的 ETag / 摘要描述的是原内容，一并去掉，免得客户端缓存或校验出错
+func setRespBody(resp *http.Response, b []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	resp.ContentLength = int64(len(b))
+	resp.TransferEncoding = nil
+	resp.Header.Del("Transfer-Encoding")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(b)))
+	for _, k := range []string{"ETag", "Content-MD5", "Digest", "Content-Digest", "Repr-Digest"} {
+		resp.Header.Del(k)
+	}
+}
+
+// hasBody 判断响应是否可能带 body
+func hasBody(resp *http.Response) bool {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return false
+	}
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified || resp.StatusCode < 200 {
+		return false
+	}
+	return resp.Request == nil || resp.Request.Method != http.MethodHead
+}
+
+// setReqBody 写回请求 body，并同步 GetBody 以便重试
+func setReqBody(req *http.Request, b []byte) {
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(b)), nil }
+	req.ContentLength = int64(len(b))
+	req.TransferEncoding = nil
+	req.Header.Del("Transfer-Encoding")
+	req.Header.Del("Content-Length") // 由 ContentLength 决定
+}
+
+// editBody 解压 → fn 改写 → 按原编码压缩。
+// 返回值三选一：改写后的 body；原 body（fn 或编解码失败，同时返回 err）；
+// 超限时未读完、可继续透传的 rest。
+func editBody(h http.Header, rc io.ReadCloser, fn func([]byte) ([]byte, error)) (b []byte, rest io.ReadCloser, err error) {
+	raw, rest, ok, err := readAll(rc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, rest, fmt.Errorf("body larger than %d bytes, left untouched", maxBody)
+	}
+
+	enc := encoding(h)
+	plain, err := decode(raw, enc)
+	if err != nil {
+		return raw, nil, err
+	}
+	if plain, err = fn(plain); err != nil {
+		return raw, nil, err
+	}
+	out, err := encode(plain, enc)
+	if err != nil {
+		return raw, nil, err
+	}
+	return out, nil, nil
+}
+
+func editResponse(resp *http.Response, fn func([]byte) ([]byte, error)) error {
+	b, rest, err := editBody(resp.Header, resp.Body, fn)
+	switch {
+	case rest != nil:
+		resp.Body = rest
+	case b == nil: // 读取失败，body 已不可用，长度也要跟着清掉
+		resp.Body = http.NoBody
+		resp.ContentLength = 0
+		resp.TransferEncoding = nil
+		resp.Header.Del("Transfer-Encoding")
+		resp.Header.Del("Content-Length")
+	case err != nil:
+		resp.Body = io.NopCloser(bytes.NewReader(b)) // 原样的 body，header 仍然有效
+	default:
+		setRespBody(resp, b)
+	}
+	return err
+}
+
+func editRequest(req *http.Request, fn func([]byte) ([]byte, error)) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	b, rest, err := editBody(req.Header, req.Body, fn)
+	switch {
+	case rest != nil:
+		req.Body = rest
+	case b == nil:
+		req.Body = http.NoBody
+		req.ContentLength = 0
+		req.TransferEncoding = nil
+		req.Header.Del("Transfer-Encoding")
+		req.Header.Del("Content-Length")
+	default:
+		setReqBody(req, b)
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package rewrite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func gzipped(s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestEditResponseValidators(t *testing.T) {
+	newResp := func(body []byte, enc string) *http.Response {
+		h := http.Header{
+			"Etag":           {`"abc"`},
+			"Content-Md5":    {"xyz"},
+			"Content-Digest": {"sha-256=:x:"},
+			"Last-Modified":  {"Mon, 02 Jan 2006 15:04:05 GMT"},
+		}
+		if enc != "" {
+			h.Set("Content-Encoding", enc)
+		}
+		return &http.Response{StatusCode: 200, Header: h, ContentLength: -1, TransferEncoding: []string{"chunked"}, Body: io.NopCloser(bytes.NewReader(body))}
+	}
+
+	for _, enc := range []string{"", "gzip"} {
+		body := []byte("hello")
+		if enc == "gzip" {
+			body = gzipped("hello")
+		}
+
+		resp := newResp(body, enc)
+		err := editResponse(resp, func(b []byte) ([]byte, error) { return append(b, '!'), nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range []string{"ETag", "Content-MD5", "Content-Digest"} {
+			if v := resp.Header.Get(k); v != "" {
+				t.Errorf("%s: %s survived the rewrite: %q", enc, k, v)
+			}
+		}
+		out, _ := io.ReadAll(resp.Body)
+		if resp.Header.Get("Last-Modified") == "" || resp.ContentLength != int64(len(out)) || resp.TransferEncoding != nil {
+			t.Errorf("%s: header %v, length %d for %d bytes", enc, resp.Header, resp.ContentLength, len(out))
+		}
+
+		resp = newResp(body, enc)
+		err = editResponse(resp, func([]byte) ([]byte, error) { return nil, errors.New("no") })
+		out, _ = io.ReadAll(resp.Body)
+		if err == nil || !bytes.Equal(out, body) || resp.Header.Get("ETag") != `"abc"` || resp.ContentLength != -1 {
+			t.Errorf("%s: failed edit changed the response: err %v, header %v, body %q", enc, err, resp.Header, out)
+		}
+	}
+}
+
+type failReader struct{}
+
+func (failReader) Read([]byte) (int, error) { return 0, errors.New("reset") }
+func (failReader) Close() error             { return nil }
+
+func TestEditBodyReadError(t *testing.T) {
+	resp := &http.Response{StatusCode: 200, Header: http.Header{"Content-Length": {"42"}}, ContentLength: 42, Body: failReader{}}
+	if err := editResponse(resp, func(b []byte) ([]byte, error) { return b, nil }); err == nil {
+		t.Error("response: read error not reported")
+	}
+	if resp.Body != http.NoBody || resp.ContentLength != 0 || resp.Header.Get("Content-Length") != "" {
+		t.Errorf("response: length %d, header %v after a failed read", resp.ContentLength, resp.Header)
+	}
+
+	req, _ := http.NewRequest("POST", "http://a.test/", failReader{})
+	req.ContentLength = 42
+	req.Header.Set("Content-Length", "42")
+	if err := editRequest(req, func(b []byte) ([]byte, error) { return b, nil }); err == nil {
+		t.Error("request: read error not reported")
+	}
+	if req.Body != http.NoBody || req.ContentLength != 0 || req.Header.Get("Content-Length") != "" {
+		t.Errorf("request: length %d, header %v after a failed read", req.ContentLength, req.Header)
+	}
+}
@@ -0,0 +1,199 @@
+package rewrite
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sonacy/go-whistle-lite/grpcx"
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ---------- header / cookie / redirect / cors ---------- */
+
+// ApplyHeader 执行 reqHeader / respHeader：Add:K=V / Set:K=V / Del:K
+func ApplyHeader(h http.Header, p string) {
+	op, k, v := rules.ParseHeaderParam(p)
+	switch strings.ToLower(op) {
+	case "add":
+		h.Add(k, v)
+	case "set":
+		h.Set(k, v)
+	case "del", "remove":
+		h.Del(k)
+	}
+}
+
+// ApplyReqCookie 只改动 Cookie 头中的单个 cookie：Add:k=v / Set:k=v / Del:k
+func ApplyReqCookie(h http.Header, p string) {
+	op, name, val := rules.ParseHeaderParam(p)
+	op = strings.ToLower(op)
+
+	var kept []string
+	for _, line := range h.Values("Cookie") {
+		for _, c := range strings.Split(line, ";") {
+			c = strings.TrimSpace(c)
+			if c == "" {
+				continue
+			}
+			if n, _, _ := strings.Cut(c, "="); n == name && op != "add" {
+				continue // set / del 先去掉同名 cookie
+			}
+			kept = append(kept, c)
+		}
+	}
+	if op == "add" || op == "set" {
+		kept = append(kept, name+"="+val)
+	}
+	if len(kept) == 0 {
+		h.Del("Cookie")
+		return
+	}
+	ApplyHeader(h, "Set:Cookie="+strings.Join(kept, "; "))
+}
+
+// ApplyResCookie 只改动同名的 Set-Cookie 行；val 可带属性（sid=1;Path=/;HttpOnly）
+func ApplyResCookie(h http.Header, p string) {
+	op, name, val := rules.ParseHeaderParam(p)
+	op = strings.ToLower(op)
+
+	if op != "add" {
+		var kept []string
+		for _, line := range h.Values("Set-Cookie") {
+			if n, _, _ := strings.Cut(line, "="); strings.TrimSpace(n) != name {
+				kept = append(kept, line)
+			}
+		}
+		h.Del("Set-Cookie")
+		for _, line := range kept {
+			ApplyHeader(h, "Add:Set-Cookie="+line)
+		}
+	}
+	if op == "add" || op == "set" {
+		ApplyHeader(h, "Add:Set-Cookie="+name+"="+val)
+	}
+}
+
+// LocalResponse 返回由代理直接应答的响应（redirect / CORS 预检 / grpc 模拟）；需要转发时返回 nil
+func LocalResponse(r *http.Request, a rules.Action) *http.Response {
+	switch a.Name {
+	case rules.ActRedirect:
+		code, loc := rules.ParseRedirect(a.Param)
+		resp := newResponse(r, code)
+		resp.Header.Set("Location", loc)
+		return resp
+	case rules.ActCORS:
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			return nil
+		}
+		resp := newResponse(r, http.StatusNoContent)
+		if !corsHeaders(resp.Header, r.Header, a.Param) {
+			return resp
+		}
+		resp.Header.Set("Access-Control-Allow-Methods", r.Header.Get("Access-Control-Request-Method"))
+		if hs := r.Header.Get("Access-Control-Request-Headers"); hs != "" {
+			resp.Header.Set("Access-Control-Allow-Headers", hs)
+		}
+		resp.Header.Set("Access-Control-Max-Age", "600")
+		return resp
+	case rules.ActGRPC:
+		return grpcx.Response(r, a.Param)
+	}
+	return nil
+}
+
+// StatusResponse 返回 status:// 的空 body 应答（供 HTTP/1 原始连接写回）
+func StatusResponse(r *http.Request, code int) *http.Response {
+	return newResponse(r, code)
+}
+
+// WriteLocal 把 LocalResponse 写给 ResponseWriter
+func WriteLocal(w http.ResponseWriter, resp *http.Response) {
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+	for k, v := range resp.Trailer {
+		w.Header()[http.TrailerPrefix+k] = v
+	}
+}
+
+// Forward 把上游响应写给 ResponseWriter：长度未知（SSE、gRPC 流）时边读边 flush，结束后补上 trailer
+func Forward(w http.ResponseWriter, resp *http.Response) {
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	var dst io.Writer = w
+	if f, ok := w.(http.Flusher); ok && resp.ContentLength < 0 {
+		dst = flushWriter{w, f}
+	}
+	io.Copy(dst, resp.Body)
+	for k, v := range resp.Trailer { // body 读完后 Trailer 才有值
+		w.Header()[http.TrailerPrefix+k] = v
+	}
+}
+
+type flushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.f.Flush()
+	return n, err
+}
+
+func newResponse(r *http.Request, code int) *http.Response {
+	return &http.Response{
+		Status:     strconv.Itoa(code) + " " + http.StatusText(code),
+		StatusCode: code,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Length": {"0"}},
+		Body:       io.NopCloser(bytes.NewReader(nil)),
+		Request:    r,
+	}
+}
+
+// corsHeaders 回显允许的 Origin 并允许携带凭据；Origin 不在白名单时返回 false
+func corsHeaders(h, req http.Header, allow string) bool {
+	origin := req.Get("Origin")
+	if origin == "" || !originAllowed(origin, allow) {
+		return false
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Set("Access-Control-Allow-Credentials", "true")
+	h.Add("Vary", "Origin")
+	return true
+}
+
+// exposeHeaders 让页面脚本能读到所有响应头（带凭据时不能用 *）
+func exposeHeaders(h http.Header) {
+	var names []string
+	for k := range h {
+		if !strings.HasPrefix(k, "Access-Control-") && k != "Set-Cookie" {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	h.Set("Access-Control-Expose-Headers", strings.Join(names, ", "))
+}
+
+func originAllowed(origin, allow string) bool {
+	if allow == "" || allow == "*" {
+		return true
+	}
+	for _, o := range strings.Split(allow, ",") {
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
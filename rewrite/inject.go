@@ -0,0 +1,186 @@
+package rewrite
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ---------- html / js / css 注入 ----------
+ *
+ * htmlPrepend / htmlAppend   仅对 text/html
+ * jsPrepend / jsAppend       对 JS 原样拼接；对 HTML 包一层 <script>
+ * cssPrepend / cssAppend     对 CSS 原样拼接；对 HTML 包一层 <style>
+ * 参数为内联文本或 @file（每次读取，修改即生效）。
+ */
+
+type kind int
+
+const (
+	kindOther kind = iota
+	kindHTML
+	kindJS
+	kindCSS
+)
+
+func contentKind(ct string) kind {
+	mt, _, _ := mime.ParseMediaType(ct)
+	switch mt {
+	case "text/html", "application/xhtml+xml":
+		return kindHTML
+	case "application/javascript", "text/javascript", "application/x-javascript", "application/ecmascript", "text/ecmascript":
+		return kindJS
+	case "text/css":
+		return kindCSS
+	}
+	return kindOther
+}
+
+// injection 返回动作对当前内容类型要拼接的文本；不适用时 ok=false
+func injection(a rules.Action, k kind) (text []byte, prepend, ok bool) {
+	var target kind
+	switch a.Name {
+	case rules.ActHTMLPrepend, rules.ActHTMLAppend:
+		target = kindHTML
+	case rules.ActJSPrepend, rules.ActJSAppend:
+		target = kindJS
+	case rules.ActCSSPrepend, rules.ActCSSAppend:
+		target = kindCSS
+	default:
+		return nil, false, false
+	}
+	if k != target && k != kindHTML {
+		return nil, false, false
+	}
+
+	text, err := content(a.Param)
+	if err != nil {
+		logx.D("[inject] %s: %v", a, err)
+		return nil, false, false
+	}
+	if k == kindHTML && target == kindJS {
+		text = append(append([]byte("<script>"), text...), "</script>"...)
+	}
+	if k == kindHTML && target == kindCSS {
+		text = append(append([]byte("<style>"), text...), "</style>"...)
+	}
+	prepend = a.Name == rules.ActHTMLPrepend || a.Name == rules.ActJSPrepend || a.Name == rules.ActCSSPrepend
+	if k != kindHTML { // 原样拼接 JS / CSS 时用换行隔开，避免与原内容粘连
+		if prepend {
+			text = append(text, '\n')
+		} else {
+			text = append([]byte{'\n'}, text...)
+		}
+	}
+	return text, prepend, true
+}
+
+func content(p string) ([]byte, error) {
+	if strings.HasPrefix(p, "@") {
+		return os.ReadFile(p[1:])
+	}
+	return []byte(p), nil
+}
+
+// wantsInjection 判断规则是否带注入动作
+func wantsInjection(ru *rules.Rule) bool {
+	if ru == nil {
+		return false
+	}
+	for _, a := range ru.Actions {
+		if isInject(a.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func isInject(name string) bool {
+	switch name {
+	case rules.ActHTMLPrepend, rules.ActHTMLAppend, rules.ActJSPrepend, rules.ActJSAppend, rules.ActCSSPrepend, rules.ActCSSAppend:
+		return true
+	}
+	return false
+}
+
+func inject(resp *http.Response, ru *rules.Rule, b []byte) []byte {
+	k := contentKind(resp.Header.Get("Content-Type"))
+	var head, tail [][]byte
+	for _, a := range ru.Actions {
+		text, prepend, ok := injection(a, k)
+		if !ok {
+			continue
+		}
+		if prepend {
+			head = append(head, text)
+		} else {
+			tail = append(tail, text)
+		}
+	}
+	if len(head)+len(tail) == 0 {
+		return b
+	}
+	if k == kindHTML {
+		relaxCSP(resp.Header)
+	}
+	out := bytes.Join(append(head, b), nil)
+	return bytes.Join(append([][]byte{out}, tail...), nil)
+}
+
+/* ---------- CSP: 让注入的内联 script / style 可执行 ---------- */
+
+// relaxCSP 去掉 hash / nonce / strict-dynamic 并加上 'unsafe-inline'
+// （存在 hash 或 nonce 时浏览器会忽略 'unsafe-inline'）
+func relaxCSP(h http.Header) {
+	for _, name := range []string{"Content-Security-Policy", "Content-Security-Policy-Report-Only"} {
+		vs := h.Values(name)
+		if len(vs) == 0 {
+			continue
+		}
+		out := make([]string, len(vs))
+		for i, v := range vs {
+			out[i] = relaxPolicy(v)
+		}
+		h[name] = out
+	}
+}
+
+func relaxPolicy(policy string) string {
+	dirs := strings.Split(policy, ";")
+	for i, d := range dirs {
+		f := strings.Fields(d)
+		if len(f) == 0 {
+			continue
+		}
+		switch strings.ToLower(f[0]) {
+		case "default-src", "script-src", "script-src-elem", "style-src", "style-src-elem":
+		default:
+			continue
+		}
+		kept := []string{f[0]}
+		inline := false
+		for _, src := range f[1:] {
+			l := strings.ToLower(src)
+			switch {
+			case strings.HasPrefix(l, "'sha256-"), strings.HasPrefix(l, "'sha384-"), strings.HasPrefix(l, "'sha512-"),
+				strings.HasPrefix(l, "'nonce-"), l == "'strict-dynamic'":
+				continue
+			case l == "'unsafe-inline'":
+				inline = true
+			case l == "'none'":
+				continue
+			}
+			kept = append(kept, src)
+		}
+		if !inline {
+			kept = append(kept, "'unsafe-inline'")
+		}
+		dirs[i] = " " + strings.Join(kept, " ")
+	}
+	return strings.TrimSpace(strings.Join(dirs, ";"))
+}
@@ -0,0 +1,339 @@
+package rewrite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/* ---------- JSON body: merge (RFC 7386) / patch (RFC 6902) ---------- */
+
+// loadJSON 解析内联 JSON 或 @file（每次读取，修改即生效）
+func loadJSON(p string) (any, error) {
+	b, err := content(p)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSON(b)
+}
+
+func parseJSON(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber() // 保留大整数精度
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	// 只允许一个值：`{"a":1} junk` 之类的尾随内容按错误处理
+	var rest json.RawMessage
+	if err := dec.Decode(&rest); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value at offset %d", dec.InputOffset())
+	}
+	return v, nil
+}
+
+func marshalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+// mergeJSON 把 param 深度合并进 body；param 中的 null 表示删除该字段
+func mergeJSON(body []byte, param string) ([]byte, error) {
+	patch, err := loadJSON(param)
+	if err != nil {
+		return nil, fmt.Errorf("merge param: %v", err)
+	}
+	doc, err := parseJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("body is not JSON: %v", err)
+	}
+	return marshalJSON(merge(doc, patch))
+}
+
+func merge(dst, src any) any {
+	sm, ok := src.(map[string]any)
+	if !ok {
+		return src
+	}
+	dm, ok := dst.(map[string]any)
+	if !ok {
+		dm = map[string]any{}
+	}
+	for k, v := range sm {
+		if v == nil {
+			delete(dm, k)
+			continue
+		}
+		dm[k] = merge(dm[k], v)
+	}
+	return dm
+}
+
+// patchJSON 按 RFC 6902 依次执行 op；任一 op 失败则整体放弃
+func patchJSON(body []byte, param string) ([]byte, error) {
+	raw, err := content(param)
+	if err != nil {
+		return nil, err
+	}
+	var ops []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		From  string          `json:"from"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &ops); err != nil {
+		return nil, fmt.Errorf("patch param: %v", err)
+	}
+	doc, err := parseJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("body is not JSON: %v", err)
+	}
+
+	for i, op := range ops {
+		var val any
+		switch {
+		case len(op.Value) > 0:
+			if val, err = parseJSON(op.Value); err != nil {
+				return nil, fmt.Errorf("op #%d value: %v", i, err)
+			}
+		case op.Op == "add" || op.Op == "replace" || op.Op == "test": // RFC 6902 §4：value 必填（null 也算有）
+			return nil, fmt.Errorf("op #%d: missing value", i)
+		}
+		switch op.Op {
+		case "add":
+			doc, err = ptrAdd(doc, op.Path, val)
+		case "remove":
+			doc, _, err = ptrRemove(doc, op.Path)
+		case "replace":
+			if doc, _, err = ptrRemove(doc, op.Path); err == nil {
+				doc, err = ptrAdd(doc, op.Path, val)
+			}
+		case "move":
+			var v any
+			if doc, v, err = ptrRemove(doc, op.From); err == nil {
+				doc, err = ptrAdd(doc, op.Path, v)
+			}
+		case "copy":
+			var v any
+			if v, err = ptrGet(doc, op.From); err == nil {
+				doc, err = ptrAdd(doc, op.Path, clone(v))
+			}
+		case "test":
+			var v any
+			if v, err = ptrGet(doc, op.Path); err == nil && !equalJSON(v, val) {
+				err = fmt.Errorf("test failed at %q", op.Path)
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("op #%d %s %s: %v", i, op.Op, op.Path, err)
+		}
+	}
+	return marshalJSON(doc)
+}
+
+/* ---------- JSON pointer (RFC 6901) ---------- */
+
+func splitPtr(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("pointer %q must start with /", p)
+	}
+	toks := strings.Split(p[1:], "/")
+	for i, t := range toks {
+		toks[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return toks, nil
+}
+
+func index(tok string, n int, allowEnd bool) (int, error) {
+	if allowEnd && tok == "-" {
+		return n, nil
+	}
+	i, err := strconv.Atoi(tok)
+	if err != nil || i < 0 || i > n || (!allowEnd && i == n) {
+		return 0, fmt.Errorf("bad array index %q", tok)
+	}
+	return i, nil
+}
+
+func ptrGet(doc any, p string) (any, error) {
+	toks, err := splitPtr(p)
+	if err != nil {
+		return nil, err
+	}
+	cur := doc
+	for _, t := range toks {
+		switch c := cur.(type) {
+		case map[string]any:
+			v, ok := c[t]
+			if !ok {
+				return nil, fmt.Errorf("no member %q", t)
+			}
+			cur = v
+		case []any:
+			i, err := index(t, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			cur = c[i]
+		default:
+			return nil, fmt.Errorf("cannot descend into %T", cur)
+		}
+	}
+	return cur, nil
+}
+
+// ptrAdd 返回新的根（根本身可能被替换）
+func ptrAdd(doc any, p string, val any) (any, error) {
+	toks, err := splitPtr(p)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return val, nil
+	}
+	parent, err := ptrGet(doc, joinPtr(toks[:len(toks)-1]))
+	if err != nil {
+		return nil, err
+	}
+	last := toks[len(toks)-1]
+	switch c := parent.(type) {
+	case map[string]any:
+		c[last] = val
+	case []any:
+		i, err := index(last, len(c), true)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, nil)
+		copy(c[i+1:], c[i:])
+		c[i] = val
+		return setAt(doc, toks[:len(toks)-1], c)
+	default:
+		return nil, fmt.Errorf("cannot add to %T", parent)
+	}
+	return doc, nil
+}
+
+// ptrRemove 删除并返回被删除的值
+func ptrRemove(doc any, p string) (any, any, error) {
+	toks, err := splitPtr(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(toks) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := ptrGet(doc, joinPtr(toks[:len(toks)-1]))
+	if err != nil {
+		return nil, nil, err
+	}
+	last := toks[len(toks)-1]
+	switch c := parent.(type) {
+	case map[string]any:
+		v, ok := c[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("no member %q", last)
+		}
+		delete(c, last)
+		return doc, v, nil
+	case []any:
+		i, err := index(last, len(c), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := c[i]
+		c = append(c[:i:i], c[i+1:]...)
+		doc, err = setAt(doc, toks[:len(toks)-1], c)
+		return doc, v, err
+	}
+	return nil, nil, fmt.Errorf("cannot remove from %T", parent)
+}
+
+// setAt 把 toks 指向的位置替换为 v（数组长度变化后需要回写到父节点）
+func setAt(doc any, toks []string, v any) (any, error) {
+	if len(toks) == 0 {
+		return v, nil
+	}
+	parent, err := ptrGet(doc, joinPtr(toks[:len(toks)-1]))
+	if err != nil {
+		return nil, err
+	}
+	last := toks[len(toks)-1]
+	switch c := parent.(type) {
+	case map[string]any:
+		c[last] = v
+	case []any:
+		i, err := index(last, len(c), false)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = v
+	}
+	return doc, nil
+}
+
+func joinPtr(toks []string) string {
+	var b strings.Builder
+	for _, t := range toks {
+		b.WriteByte('/')
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(t, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
+
+func clone(v any) any {
+	b, _ := json.Marshal(v)
+	c, _ := parseJSON(b)
+	return c
+}
+
+// equalJSON 按 RFC 6902 test 的语义比较：数字按数值（1 与 1.0 相等），对象不论顺序
+func equalJSON(a, b any) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		rx, okx := new(big.Rat).SetString(string(x))
+		ry, oky := new(big.Rat).SetString(string(y))
+		return okx && oky && rx.Cmp(ry) == 0
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			if w, ok := y[k]; !ok || !equalJSON(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalJSON(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b // string / bool / nil
+}
@@ -0,0 +1,78 @@
+package rewrite
+
+import (
+	"testing"
+)
+
+func TestMergeJSON(t *testing.T) {
+	cases := []struct{ body, param, want string }{
+		{`{"a":1,"b":{"c":2,"d":3}}`, `{"b":{"c":null,"e":4}}`, `{"a":1,"b":{"d":3,"e":4}}`},
+		{`{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`}, // 数组整体替换
+		{`{"a":1}`, `{"a":{"b":1}}`, `{"a":{"b":1}}`},
+		{`[1]`, `{"a":1}`, `{"a":1}`},
+		{`{"big":12345678901234567890}`, `{}`, `{"big":12345678901234567890}`}, // 大整数不丢精度
+	}
+	for _, bad := range []string{`{"a":1} junk`, `{"a":1}]`} {
+		if got, err := mergeJSON([]byte(`{}`), bad); err == nil {
+			t.Errorf("merge param %s accepted: %s", bad, got)
+		}
+	}
+	for _, c := range cases {
+		got, err := mergeJSON([]byte(c.body), c.param)
+		if err != nil || string(got) != c.want {
+			t.Errorf("merge %s into %s = %s, %v; want %s", c.param, c.body, got, err, c.want)
+		}
+	}
+}
+
+func TestPatchJSON(t *testing.T) {
+	cases := []struct {
+		name, body, ops, want string // want 为空表示应当失败
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`},
+		{"append with -", `{"a":[1,2]}`, `[{"op":"add","path":"/a/-","value":3}]`, `{"a":[1,2,3]}`},
+		{"insert at index", `{"a":[1,2]}`, `[{"op":"add","path":"/a/0","value":0}]`, `{"a":[0,1,2]}`},
+		{"insert at end index", `{"a":[1,2]}`, `[{"op":"add","path":"/a/2","value":3}]`, `{"a":[1,2,3]}`},
+		{"index past end", `{"a":[1,2]}`, `[{"op":"add","path":"/a/3","value":3}]`, ""},
+		{"remove - is not an element", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/-"}]`, ""},
+		{"remove element", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`},
+		{"remove missing", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, ""},
+		{"replace", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/1","value":"x"}]`, `{"a":[1,"x"]}`},
+		{"replace root", `{"a":1}`, `[{"op":"replace","path":"","value":[true]}]`, `[true]`},
+		{"add root", `{"a":1}`, `[{"op":"add","path":"","value":{"b":2}}]`, `{"b":2}`},
+		{"move between arrays", `{"a":[1,2],"b":[]}`, `[{"op":"move","from":"/a/0","path":"/b/-"}]`, `{"a":[2],"b":[1]}`},
+		{"move within array", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/2"}]`, `{"a":[2,3,1]}`},
+		{"move member", `{"a":{"x":1},"b":{}}`, `[{"op":"move","from":"/a/x","path":"/b/y"}]`, `{"a":{},"b":{"y":1}}`},
+		{"copy is deep", `{"a":{"x":[1]}}`, `[{"op":"copy","from":"/a","path":"/b"},{"op":"add","path":"/b/x/-","value":2}]`, `{"a":{"x":[1]},"b":{"x":[1,2]}}`},
+		{"escaped pointer", `{"a/b":{"~c":1}}`, `[{"op":"replace","path":"/a~1b/~0c","value":2}]`, `{"a/b":{"~c":2}}`},
+		{"test number numerically", `{"n":1}`, `[{"op":"test","path":"/n","value":1.0},{"op":"add","path":"/ok","value":true}]`, `{"n":1,"ok":true}`},
+		{"test exponent", `{"n":100}`, `[{"op":"test","path":"/n","value":1e2}]`, `{"n":100}`},
+		{"test object order", `{"o":{"a":1,"b":[1,"x"]}}`, `[{"op":"test","path":"/o","value":{"b":[1,"x"],"a":1}}]`, `{"o":{"a":1,"b":[1,"x"]}}`},
+		{"test number vs string", `{"n":1}`, `[{"op":"test","path":"/n","value":"1"}]`, ""},
+		{"test different", `{"n":1}`, `[{"op":"test","path":"/n","value":2}]`, ""},
+		{"failed op discards earlier ones", `{"a":1}`, `[{"op":"add","path":"/b","value":2},{"op":"remove","path":"/c"}]`, ""},
+		{"bad pointer", `{"a":1}`, `[{"op":"add","path":"a","value":2}]`, ""},
+		{"unknown op", `{"a":1}`, `[{"op":"frob","path":"/a"}]`, ""},
+		{"add without value", `{"a":1}`, `[{"op":"add","path":"/b"}]`, ""},
+		{"replace without value", `{"a":1}`, `[{"op":"replace","path":"/a"}]`, ""},
+		{"test without value", `{"a":null}`, `[{"op":"test","path":"/a"}]`, ""},
+		{"null is a value", `{"a":1}`, `[{"op":"replace","path":"/a","value":null}]`, `{"a":null}`},
+		{"trailing data in body", `{"a":1} junk`, `[{"op":"remove","path":"/a"}]`, ""},
+		{"second value in body", `{"a":1}{}`, `[{"op":"remove","path":"/a"}]`, ""},
+		{"trailing whitespace", "{\"a\":1}\n ", `[{"op":"remove","path":"/a"}]`, `{}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := patchJSON([]byte(c.body), c.ops)
+			if c.want == "" {
+				if err == nil {
+					t.Errorf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil || string(got) != c.want {
+				t.Errorf("got %s, %v; want %s", got, err, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package rewrite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ---------- mapLocal：内联文本 / @file / @dir/ ----------
+ *
+ * @dir/ 按请求路径映射到目录：规则 path 以 * 结尾时去掉前缀部分。
+ * 目录请求返回 index.html；找不到且路径没有扩展名时回退到 index.html（SPA）。
+ * 文件经 http.ServeContent 输出，支持 Range / If-Range / ETag / If-Modified-Since / HEAD。
+ * 明文代理与 MITM H2 直接写 ResponseWriter；MITM H1 的原始连接经 Local 边读边写，
+ * 三条路径都不在内存中缓冲文件内容。
+ */
+
+func init() {
+	for ext, typ := range map[string]string{
+		".map":         "application/json",
+		".mjs":         "text/javascript; charset=utf-8",
+		".woff":        "font/woff",
+		".woff2":       "font/woff2",
+		".ttf":         "font/ttf",
+		".otf":         "font/otf",
+		".ico":         "image/x-icon",
+		".txt":         "text/plain; charset=utf-8",
+		".md":          "text/markdown; charset=utf-8",
+		".mp4":         "video/mp4",
+		".webm":        "video/webm",
+		".mp3":         "audio/mpeg",
+		".webmanifest": "application/manifest+json",
+	} {
+		if mime.TypeByExtension(ext) == "" {
+			mime.AddExtensionType(ext, typ)
+		}
+	}
+}
+
+// ServeLocal 把 mapLocal 的内容直接写给 ResponseWriter
+func ServeLocal(w http.ResponseWriter, r *http.Request, ru *rules.Rule, p string) {
+	serveLocal(w, r, ru, p)
+}
+
+// Local 生成 mapLocal 的响应，body 边读文件边输出（供 HTTP/1 原始连接写回）；
+// 调用方写完后须关闭 Body
+func Local(r *http.Request, ru *rules.Rule, p string) *http.Response {
+	pw := newPipeWriter()
+	go func() {
+		serveLocal(pw, r, ru, p)
+		pw.close()
+	}()
+	return pw.response(r)
+}
+
+// Record 在内存中执行 h，把结果转成 *http.Response（供 HTTP/1 原始连接写回）
+func Record(r *http.Request, h http.Handler) *http.Response {
+	bw := &bufWriter{h: http.Header{}}
+	h.ServeHTTP(bw, r)
+	return bw.response(r)
+}
+
+func serveLocal(w http.ResponseWriter, r *http.Request, ru *rules.Rule, p string) {
+	name, ok := strings.CutPrefix(p, "@")
+	if !ok {
+		w.Header().Set("Content-Length", strconv.Itoa(len(p)))
+		w.Write([]byte(p))
+		return
+	}
+	if strings.HasSuffix(name, "/") || isDir(name) {
+		name = dirFile(name, localSuffix(ru, r.URL.Path))
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		http.Error(w, "mapLocal: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.Error(w, "mapLocal: not a file", http.StatusNotFound)
+		return
+	}
+	// 强校验值（同 nginx：大小 + 纳秒 mtime），If-Range 只接受强 ETag
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, fi.Size(), fi.ModTime().UnixNano()))
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
+
+// localSuffix 返回映射到目录下的相对路径
+func localSuffix(ru *rules.Rule, urlPath string) string {
+	if prefix, ok := strings.CutSuffix(ru.PathRaw, "*"); ok {
+		return strings.TrimPrefix(urlPath, prefix)
+	}
+	return urlPath
+}
+
+// dirFile 在 dir 下定位文件：目录 → index.html，缺失的无扩展名路径 → index.html
+func dirFile(dir, rel string) string {
+	rel = path.Clean("/" + rel) // 去掉 .. 防止越出目录
+	name := filepath.Join(dir, filepath.FromSlash(rel))
+	switch fi, err := os.Stat(name); {
+	case err == nil && fi.IsDir():
+		return filepath.Join(name, "index.html")
+	case err != nil && path.Ext(rel) == "":
+		return filepath.Join(dir, "index.html")
+	}
+	return name
+}
+
+func isDir(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.IsDir()
+}
+
+/* ---------- 把 handler 输出转为 *http.Response：pipeWriter 流式，bufWriter 缓冲 ---------- */
+
+type pipeWriter struct {
+	h     http.Header
+	sent  http.Header // WriteHeader 时的副本，之后 handler 再改 h 也不影响响应
+	code  int
+	ready chan struct{} // WriteHeader 后关闭
+	pr    *io.PipeReader
+	pw    *io.PipeWriter
+}
+
+func newPipeWriter() *pipeWriter {
+	pr, pw := io.Pipe()
+	return &pipeWriter{h: http.Header{}, ready: make(chan struct{}), pr: pr, pw: pw}
+}
+
+func (p *pipeWriter) Header() http.Header { return p.h }
+
+func (p *pipeWriter) WriteHeader(code int) {
+	if p.code == 0 {
+		p.code, p.sent = code, p.h.Clone()
+		close(p.ready)
+	}
+}
+
+func (p *pipeWriter) Write(b []byte) (int, error) {
+	p.WriteHeader(http.StatusOK)
+	return p.pw.Write(b)
+}
+
+func (p *pipeWriter) close() {
+	p.WriteHeader(http.StatusOK)
+	p.pw.Close()
+}
+
+func (p *pipeWriter) response(r *http.Request) *http.Response {
+	<-p.ready
+	resp := &http.Response{
+		Status:        strconv.Itoa(p.code) + " " + http.StatusText(p.code),
+		StatusCode:    p.code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        p.sent,
+		ContentLength: -1,
+		Body:          p.pr,
+		Request:       r,
+	}
+	if cl, err := strconv.ParseInt(p.sent.Get("Content-Length"), 10, 64); err == nil {
+		resp.ContentLength = cl
+	}
+	switch {
+	case p.code == http.StatusNotModified || p.code == http.StatusNoContent:
+		resp.ContentLength = 0
+		p.sent.Del("Content-Length")
+	case resp.ContentLength < 0:
+		resp.TransferEncoding = []string{"chunked"} // 长度未知时分块，连接仍可复用
+	}
+	return resp
+}
+
+type bufWriter struct {
+	h    http.Header
+	code int
+	buf  bytes.Buffer
+}
+
+func (b *bufWriter) Header() http.Header { return b.h }
+
+func (b *bufWriter) WriteHeader(code int) {
+	if b.code == 0 {
+		b.code = code
+	}
+}
+
+func (b *bufWriter) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.buf.Write(p)
+}
+
+func (b *bufWriter) response(r *http.Request) *http.Response {
+	b.WriteHeader(http.StatusOK)
+	n := int64(b.buf.Len())
+	if cl, err := strconv.ParseInt(b.h.Get("Content-Length"), 10, 64); err == nil {
+		n = cl // HEAD 请求时 body 为空但保留长度
+	}
+	if b.code == http.StatusNotModified || b.code == http.StatusNoContent {
+		n = 0
+		b.h.Del("Content-Length")
+	} else {
+		b.h.Set("Content-Length", strconv.FormatInt(n, 10))
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(b.code) + " " + http.StatusText(b.code),
+		StatusCode:    b.code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        b.h,
+		ContentLength: n,
+		Body:          io.NopCloser(&b.buf),
+		Request:       r,
+	}
+}
@@ -0,0 +1,107 @@
+package rewrite
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+func localDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"index.html":      "<app>",
+		"app.js":          "0123456789",
+		"docs/index.html": "# docs",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// rawLocal 经 Local 写到原始连接再读回，与 MITM H1 的路径相同
+func rawLocal(t *testing.T, r *http.Request, ru *rules.Rule, p string) (*http.Response, string) {
+	t.Helper()
+	resp := Local(r, ru, p)
+	var conn bytes.Buffer
+	if err := resp.Write(&conn); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := http.ReadResponse(bufio.NewReader(&conn), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(back.Body)
+	if rest, _ := io.ReadAll(bufio.NewReader(&conn)); len(rest) > 0 {
+		t.Errorf("trailing bytes after response: %q", rest)
+	}
+	return back, string(body)
+}
+
+func TestServeLocal(t *testing.T) {
+	dir := localDir(t)
+	ru := &rules.Rule{PathRaw: "/static/*"}
+	etag := func() string {
+		w := httptest.NewRecorder()
+		ServeLocal(w, httptest.NewRequest("GET", "/static/app.js", nil), ru, "@"+dir)
+		return w.Header().Get("ETag")
+	}()
+	if len(etag) < 2 || etag[0] != '"' {
+		t.Fatalf("ETag %q is not a strong validator", etag)
+	}
+
+	cases := []struct {
+		name, method, path, param string
+		h                         http.Header
+		code                      int
+		body                      string
+	}{
+		{"inline", "GET", "/static/x", "hello", nil, 200, "hello"},
+		{"file", "GET", "/static/app.js", "@" + dir, nil, 200, "0123456789"},
+		{"dir index", "GET", "/static/docs/", "@" + dir, nil, 200, "# docs"},
+		{"spa fallback", "GET", "/static/users/42", "@" + dir, nil, 200, "<app>"},
+		{"missing asset", "GET", "/static/nope.css", "@" + dir, nil, 404, "mapLocal: open " + filepath.Join(dir, "nope.css") + ": no such file or directory\n"},
+		{"range", "GET", "/static/app.js", "@" + dir, http.Header{"Range": {"bytes=2-5"}}, 206, "2345"},
+		{"if-range match", "GET", "/static/app.js", "@" + dir, http.Header{"Range": {"bytes=2-5"}, "If-Range": {etag}}, 206, "2345"},
+		{"if-range stale", "GET", "/static/app.js", "@" + dir, http.Header{"Range": {"bytes=2-5"}, "If-Range": {`"old"`}}, 200, "0123456789"},
+		{"if-none-match", "GET", "/static/app.js", "@" + dir, http.Header{"If-None-Match": {etag}}, 304, ""},
+		{"head", "HEAD", "/static/app.js", "@" + dir, nil, 200, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			newReq := func() *http.Request {
+				r := httptest.NewRequest(c.method, "http://a.com"+c.path, nil)
+				for k, v := range c.h {
+					r.Header[k] = v
+				}
+				return r
+			}
+
+			w := httptest.NewRecorder()
+			ServeLocal(w, newReq(), ru, c.param)
+			if w.Code != c.code || w.Body.String() != c.body {
+				t.Errorf("ServeLocal = %d %q, want %d %q", w.Code, w.Body, c.code, c.body)
+			}
+
+			resp, body := rawLocal(t, newReq(), ru, c.param)
+			if resp.StatusCode != c.code || body != c.body {
+				t.Errorf("Local = %d %q, want %d %q", resp.StatusCode, body, c.code, c.body)
+			}
+			if c.method == "HEAD" && resp.ContentLength != 10 {
+				t.Errorf("HEAD Content-Length = %d, want 10", resp.ContentLength)
+			}
+		})
+	}
+}
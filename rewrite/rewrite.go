@@ -0,0 +1,85 @@
+package rewrite
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ---------- entry points used by proxy / mitm ---------- */
+
+// PrepareRequest 在构造上游请求后调用：应用 reqCookies / reqMerge；
+// 规则会改写响应体时限制 Accept-Encoding
+func PrepareRequest(out *http.Request, ru *rules.Rule) {
+	for _, p := range ru.Params(rules.ActReqCookies) {
+		ApplyReqCookie(out.Header, p)
+	}
+	if wantsInjection(ru) || hasAction(ru, rules.ActResMerge, rules.ActResJSONPatch) {
+		limitAcceptEncoding(out.Header)
+	}
+	ps := ru.Params(rules.ActReqMerge)
+	if len(ps) == 0 {
+		return
+	}
+	err := editRequest(out, func(b []byte) ([]byte, error) {
+		var err error
+		for _, p := range ps {
+			if b, err = mergeJSON(b, p); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	})
+	if err != nil {
+		logx.D("[rewrite] %s reqMerge: %v", ru.Pos(), err)
+	}
+}
+
+// Response 在响应写回客户端之前调用：先处理 resCookies / cors 响应头，
+// 再按规则顺序执行 resMerge / resJsonPatch，最后做注入
+func Response(resp *http.Response, ru *rules.Rule) {
+	for _, p := range ru.Params(rules.ActResCookies) {
+		ApplyResCookie(resp.Header, p)
+	}
+	if a, ok := ru.Find(rules.ActCORS); ok && resp.Request != nil && corsHeaders(resp.Header, resp.Request.Header, a.Param) {
+		exposeHeaders(resp.Header)
+	}
+
+	js := hasAction(ru, rules.ActResMerge, rules.ActResJSONPatch)
+	inj := wantsInjection(ru) && contentKind(resp.Header.Get("Content-Type")) != kindOther
+	if (!js && !inj) || !hasBody(resp) {
+		return
+	}
+	err := editResponse(resp, func(b []byte) ([]byte, error) {
+		var err error
+		for _, a := range ru.Actions {
+			switch a.Name {
+			case rules.ActResMerge:
+				b, err = mergeJSON(b, a.Param)
+			case rules.ActResJSONPatch:
+				b, err = patchJSON(b, a.Param)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", a.Name, err)
+			}
+		}
+		if inj {
+			b = inject(resp, ru, b)
+		}
+		return b, nil
+	})
+	if err != nil {
+		logx.D("[rewrite] %s: %v", ru.Pos(), err)
+	}
+}
+
+func hasAction(ru *rules.Rule, names ...string) bool {
+	for _, n := range names {
+		if _, ok := ru.Find(n); ok {
+			return true
+		}
+	}
+	return false
+}
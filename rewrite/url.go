@@ -0,0 +1,85 @@
+package rewrite
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ---------- urlParams / method / pathReplace ---------- */
+
+// URL 在构造上游请求前调用：依次应用 pathReplace 与 urlParams，返回新 URL（不改动 u）
+func URL(u *url.URL, ru *rules.Rule) *url.URL {
+	if ru == nil {
+		return u
+	}
+	out := *u
+	for _, a := range ru.Actions {
+		switch a.Name {
+		case rules.ActPathReplace:
+			re, repl, err := pathReplace(a.Param)
+			if err != nil {
+				logx.D("[rewrite] %s: %v", a, err)
+				continue
+			}
+			out.Path = re.ReplaceAllString(out.Path, repl)
+			out.RawPath = ""
+		case rules.ActURLParams:
+			out.RawQuery = applyParam(out.RawQuery, a.Param)
+		}
+	}
+	return &out
+}
+
+// Method 返回 method:// 指定的方法，没有则原样返回
+func Method(m string, ru *rules.Rule) string {
+	if a, ok := ru.Find(rules.ActMethod); ok {
+		return strings.ToUpper(a.Param)
+	}
+	return m
+}
+
+// applyParam 执行 Add:k=v / Set:k=v / Del:k，保留其余参数的原始顺序与编码；
+// k / v 按 URL 中的写法原样使用（空格写作 %20）
+func applyParam(raw, p string) string {
+	op, k, v := rules.ParseHeaderParam(p)
+	op = strings.ToLower(op)
+
+	var kept []string
+	if raw != "" {
+		for _, kv := range strings.Split(raw, "&") {
+			n, _, _ := strings.Cut(kv, "=")
+			if un, _ := url.QueryUnescape(n); (n == k || un == k) && op != "add" {
+				continue // set / del 先去掉同名参数
+			}
+			kept = append(kept, kv)
+		}
+	}
+	if op == "add" || op == "set" {
+		kept = append(kept, k+"="+v)
+	}
+	return strings.Join(kept, "&")
+}
+
+var regexCache sync.Map // param → *replacer
+
+type replacer struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+func pathReplace(p string) (*regexp.Regexp, string, error) {
+	if r, ok := regexCache.Load(p); ok {
+		return r.(*replacer).re, r.(*replacer).repl, nil
+	}
+	re, repl, err := rules.ParsePathReplace(p)
+	if err != nil {
+		return nil, "", err
+	}
+	regexCache.Store(p, &replacer{re, repl})
+	return re, repl, nil
+}
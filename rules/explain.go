@@ -0,0 +1,98 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TraceHeader 写入响应，标注命中规则的 file:line
+const TraceHeader = "X-Gw-Rule"
+
+/* ---------- explain: 逐条说明规则为何命中 / 未命中 ---------- */
+
+// Step 是单条规则的匹配结果
+type Step struct {
+	Pos     string `json:"pos"`
+	Rule    string `json:"rule"`
+	Matched bool   `json:"matched"`
+	Failed  string `json:"failed,omitempty"` // 未通过的 matcher
+	Detail  string `json:"detail,omitempty"`
+}
+
+// Trace 是一次 explain 的完整结果
+type Trace struct {
+	URL    string      `json:"url"`
+	Method string      `json:"method"`
+	Header http.Header `json:"header,omitempty"`
+	Steps  []Step      `json:"steps"`
+	Winner string      `json:"winner,omitempty"` // 生效规则的 file:line
+}
+
+// Explain 针对当前生效的规则集解释一次请求
+func Explain(u *url.URL, method string, h http.Header) *Trace {
+	load()
+	mu.RLock()
+	defer mu.RUnlock()
+	return explain(list, u, method, h)
+}
+
+// ExplainFile 针对指定规则文件解释，供 `gw-lite explain` 使用
+func ExplainFile(p string, u *url.URL, method string, h http.Header) (*Trace, error) {
+	rs, err := parseFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return explain(rs, u, method, h), nil
+}
+
+func explain(rs []*Rule, u *url.URL, method string, h http.Header) *Trace {
+	t := &Trace{URL: u.String(), Method: method, Header: h}
+	q := &reqInfo{u, method, h}
+	for _, r := range rs {
+		st := Step{Pos: r.Pos(), Rule: r.Raw}
+		switch st.Failed = r.mismatch(q); st.Failed {
+		case "host":
+			st.Detail = fmt.Sprintf("%q does not match %v", u.Host, r.Host)
+		case "path":
+			st.Detail = fmt.Sprintf("%q does not match %v", u.Path, r.Path)
+		case "":
+			st.Matched = true
+			if t.Winner == "" && r.Mods.active() { // 不生效时会继续往下匹配
+				st.Detail = "conditional (" + strings.Join(r.Mods.tokens(), " ") + "), falls through when skipped"
+			} else if t.Winner == "" {
+				t.Winner = st.Pos
+				st.Detail = "winner"
+			} else {
+				st.Detail = "shadowed by " + t.Winner
+			}
+		default:
+			st.Detail = "request does not satisfy " + st.Failed
+			st.Failed = "filter"
+		}
+		t.Steps = append(t.Steps, st)
+	}
+	return t
+}
+
+// String 以纯文本输出，CLI 与日志共用
+func (t *Trace) String() string {
+	s := fmt.Sprintf("%s %s\n", t.Method, t.URL)
+	for _, st := range t.Steps {
+		mark := "✗"
+		if st.Matched {
+			mark = "✓"
+		}
+		s += fmt.Sprintf("  %s %-20s %-50s %s\n", mark, st.Pos, st.Rule, st.Detail)
+	}
+	if t.Winner == "" {
+		for _, st := range t.Steps {
+			if st.Matched {
+				return s + "  → only conditional rules matched\n"
+			}
+		}
+		return s + "  → no rule matched\n"
+	}
+	return s + "  → winner " + t.Winner + "\n"
+}
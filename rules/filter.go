@@ -0,0 +1,148 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/* ---------- filters: host/path 之外的附加条件 ----------
+ *
+ * DSL 写在 action 之后：
+ *   method:GET,POST          请求方法之一
+ *   header:X-Env             header 存在
+ *   header:X-Env=staging*    header 值匹配（exact / 前缀 / 通配 / rx://）
+ *   query:debug=1            query 参数匹配（同上）
+ *   grpc:pkg.Service/*       gRPC 请求且方法匹配（同上）
+ */
+
+// reqInfo 是匹配所需的请求信息
+type reqInfo struct {
+	u      *url.URL
+	method string
+	h      http.Header
+}
+
+type filter interface {
+	ok(q *reqInfo) bool
+	String() string // DSL 文本，explain / 转换共用
+}
+
+type methodFilter []string
+
+func (f methodFilter) ok(q *reqInfo) bool {
+	for _, m := range f {
+		if strings.EqualFold(m, q.method) {
+			return true
+		}
+	}
+	return false
+}
+func (f methodFilter) String() string { return "method:" + strings.Join(f, ",") }
+
+// kvFilter 用于 header / query；val 为 nil 表示只要求存在
+type kvFilter struct {
+	kind string // "header" | "query"
+	key  string
+	raw  string
+	val  matcher
+}
+
+func (f *kvFilter) ok(q *reqInfo) bool {
+	var vs []string
+	if f.kind == "header" {
+		vs = q.h.Values(f.key)
+	} else {
+		vs = q.u.Query()[f.key]
+	}
+	if f.val == nil {
+		return len(vs) > 0
+	}
+	for _, v := range vs {
+		if f.val.Match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *kvFilter) String() string {
+	if f.val == nil {
+		return f.kind + ":" + f.key
+	}
+	return f.kind + ":" + f.key + "=" + f.raw
+}
+
+// isFilter 判断 token 是否为 filter；method://POST 这类同名 action 不算
+func isFilter(tok string) bool {
+	kind, arg, ok := strings.Cut(tok, ":")
+	if !ok || strings.HasPrefix(arg, "//") {
+		return false
+	}
+	switch kind {
+	case "method", "header", "query", "grpc":
+		return true
+	}
+	return false
+}
+
+func parseFilter(tok string) (filter, error) {
+	kind, arg, ok := strings.Cut(tok, ":")
+	if !ok || arg == "" {
+		return nil, fmt.Errorf("unexpected token %q (want action://param or filter)", tok)
+	}
+	switch kind {
+	case "method":
+		return newMethodFilter(strings.Split(arg, ","))
+	case "header", "query":
+		k, v, hasVal := strings.Cut(arg, "=")
+		if !hasVal {
+			return newKVFilter(kind, k, nil)
+		}
+		return newKVFilter(kind, k, &v)
+	case "grpc":
+		return newGRPCFilter(arg)
+	}
+	return nil, fmt.Errorf("unknown filter %q", kind)
+}
+
+func newMethodFilter(ms []string) (filter, error) {
+	f := make(methodFilter, 0, len(ms))
+	for _, m := range ms {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m == "" {
+			return nil, fmt.Errorf("method: empty method in %v", ms)
+		}
+		if !validMethod(m) {
+			return nil, fmt.Errorf("method: invalid method %q", m)
+		}
+		f = append(f, m)
+	}
+	if len(f) == 0 {
+		return nil, fmt.Errorf("method: no method given")
+	}
+	return f, nil
+}
+
+// newKVFilter: val 为 nil 表示只要求存在
+func newKVFilter(kind, key string, val *string) (filter, error) {
+	if key == "" {
+		return nil, fmt.Errorf("%s: empty name", kind)
+	}
+	f := &kvFilter{kind: kind, key: key}
+	if kind == "header" {
+		f.key = http.CanonicalHeaderKey(key)
+	}
+	if val == nil {
+		return f, nil
+	}
+	m, err := compileMatcher(*val)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s: %v", kind, key, err)
+	}
+	if m == nil {
+		m = exact("")
+	}
+	f.raw, f.val = *val, m
+	return f, nil
+}
@@ -0,0 +1,124 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/* ---------- gRPC：grpc:// 模拟响应 + grpc: 过滤器 ---------- */
+
+// GRPCCodes 是 gRPC 状态码名称，下标即数值
+var GRPCCodes = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND",
+	"ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION",
+	"ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+// ParseGRPCCode 接受数值或名称（不区分大小写）
+func ParseGRPCCode(s string) (int, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, n >= 0 && n < len(GRPCCodes)
+	}
+	for i, name := range GRPCCodes {
+		if strings.EqualFold(s, name) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// GRPCMock 是 grpc:// 的参数，逗号分隔：
+// status=NOT_FOUND|5、message=<URL 编码>、protoset=@api.protoset、json=@reply.json|内联 JSON（须放最后）
+type GRPCMock struct {
+	Code     int
+	Message  string
+	Protoset string // 空 = 使用 -protoset
+	JSON     string // @file 或内联；顶层为数组时逐条发送（server streaming）
+}
+
+func ParseGRPC(p string) (GRPCMock, error) {
+	var (
+		m         GRPCMock
+		hasStatus bool
+	)
+	for p != "" {
+		var item string
+		if strings.HasPrefix(p, "json=") { // 内联 JSON 里可能有逗号，取剩余全部
+			item, p = p, ""
+		} else {
+			item, p, _ = strings.Cut(p, ",")
+		}
+		k, v, _ := strings.Cut(item, "=")
+		switch k {
+		case "status":
+			c, ok := ParseGRPCCode(v)
+			if !ok {
+				return m, fmt.Errorf("unknown status %q (want 0-16 or a name such as NOT_FOUND)", v)
+			}
+			m.Code, hasStatus = c, true
+		case "message":
+			s, err := url.PathUnescape(v)
+			if err != nil {
+				return m, fmt.Errorf("message: %v", err)
+			}
+			m.Message = s
+		case "protoset":
+			f, ok := strings.CutPrefix(v, "@")
+			if !ok || f == "" {
+				return m, fmt.Errorf("protoset: want @file, got %q", v)
+			}
+			m.Protoset = f
+		case "json":
+			if v == "" || v == "@" {
+				return m, fmt.Errorf("json: empty message / file")
+			}
+			if !strings.HasPrefix(v, "@") && !json.Valid([]byte(v)) {
+				return m, fmt.Errorf("json: invalid JSON %q", v)
+			}
+			m.JSON = v
+		default:
+			return m, fmt.Errorf("unknown option %q (want status=, message=, protoset=, json=)", item)
+		}
+	}
+	if !hasStatus && m.JSON == "" {
+		return m, fmt.Errorf("want status= and/or json=")
+	}
+	return m, nil
+}
+
+// IsGRPCContentType 判断是否为 gRPC（application/grpc[+proto|;…]），不含 grpc-web：其 trailer 在 body 里
+func IsGRPCContentType(ct string) bool {
+	return ct == "application/grpc" || strings.HasPrefix(ct, "application/grpc+") || strings.HasPrefix(ct, "application/grpc;")
+}
+
+// grpcFilter 要求是 gRPC 请求（同 IsGRPCContentType），并按 package.Service/Method 匹配路径
+type grpcFilter struct {
+	raw string
+	m   matcher
+}
+
+func (f grpcFilter) ok(q *reqInfo) bool {
+	if !IsGRPCContentType(q.h.Get("Content-Type")) {
+		return false
+	}
+	return f.m.Match(strings.TrimPrefix(q.u.Path, "/"))
+}
+
+func (f grpcFilter) String() string { return "grpc:" + f.raw }
+
+// newGRPCFilter: helloworld.Greeter/SayHello、helloworld.Greeter/*、*/SayHello、rx://…
+func newGRPCFilter(p string) (filter, error) {
+	p = strings.TrimPrefix(p, "/")
+	m, err := compileMatcher(p)
+	if err != nil {
+		return nil, fmt.Errorf("grpc: %v", err)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("grpc: empty method pattern")
+	}
+	return grpcFilter{p, m}, nil
+}
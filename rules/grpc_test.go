@@ -0,0 +1,64 @@
+package rules
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestParseGRPC(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    GRPCMock
+		wantErr bool
+	}{
+		{in: "status=5", want: GRPCMock{Code: 5}},
+		{in: "status=permission_denied,message=no%20access", want: GRPCMock{Code: 7, Message: "no access"}},
+		{in: "protoset=@api.protoset,json=@reply.json", want: GRPCMock{Protoset: "api.protoset", JSON: "@reply.json"}},
+		{in: `status=NOT_FOUND,json={"a":1,"b":[2,3]}`, want: GRPCMock{Code: 5, JSON: `{"a":1,"b":[2,3]}`}},
+		{in: "", wantErr: true},
+		{in: "message=x", wantErr: true},
+		{in: "status=17", wantErr: true},
+		{in: "status=NOPE", wantErr: true},
+		{in: "protoset=api.protoset,status=0", wantErr: true},
+		{in: "json={broken", wantErr: true},
+		{in: "json=", wantErr: true},
+		{in: "status=0,foo=1", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := ParseGRPC(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("ParseGRPC(%q) error = %v, wantErr %v", c.in, err, c.wantErr)
+			continue
+		}
+		if !c.wantErr && got != c.want {
+			t.Errorf("ParseGRPC(%q) = %+v, want %+v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestGRPCFilter(t *testing.T) {
+	cases := []struct {
+		filter, ct, path string
+		want             bool
+	}{
+		{"grpc:demo.Greeter/SayHello", "application/grpc", "/demo.Greeter/SayHello", true},
+		{"grpc:/demo.Greeter/SayHello", "application/grpc+proto", "/demo.Greeter/SayHello", true},
+		{"grpc:demo.Greeter/*", "application/grpc", "/demo.Greeter/Other", true},
+		{"grpc:*/SayHello", "application/grpc", "/demo.Greeter/SayHello", true},
+		{`grpc:rx://^demo\.`, "application/grpc", "/demo.Greeter/SayHello", true},
+		{`grpc:rx://^demo\.`, "application/grpc", "/other.Svc/M", false},
+		{"grpc:demo.Greeter/*", "application/grpc-web+proto", "/demo.Greeter/SayHello", false},
+		{"grpc:demo.Greeter/*", "application/json", "/demo.Greeter/SayHello", false},
+	}
+	for _, c := range cases {
+		r, err := parseLine("a.com/* status://204 " + c.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", c.filter, err)
+		}
+		q := &reqInfo{&url.URL{Host: "a.com", Path: c.path}, "POST", http.Header{"Content-Type": {c.ct}}}
+		if got := r.mismatch(q) == ""; got != c.want {
+			t.Errorf("%s with %s %s: match = %v, want %v", c.filter, c.ct, c.path, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package rules
+
+import (
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+/* ---------- compiled index ----------
+ *
+ * 规则按 host 分桶：精确 host → map，"*.domain" → 反向 label trie，
+ * 无 host → any，其余（通配 / 正则）→ slow。每个桶内再按 path 分：
+ * 精确 path → map，前缀 path（含 "^/literal" 开头的正则）→ 字节 trie，其余 → slow。
+ * 查询时收集所有候选规则的下标，按原顺序逐条完整校验（含 filter），第一条通过者胜出，
+ * 因此结果与线性扫描完全一致。
+ */
+
+type index struct {
+	rules []*Rule
+	hosts map[string]*pathIndex
+	wild  *labelNode
+	any   *pathIndex
+	slow  []int // host 不可索引
+}
+
+type pathIndex struct {
+	all    []int // 无 path matcher
+	exact  map[string][]int
+	prefix *byteNode
+	slow   []int // path 不可索引
+}
+
+type labelNode struct {
+	next  map[string]*labelNode
+	paths *pathIndex // 非空表示此处有 "*.xxx" 规则结束
+}
+
+type byteNode struct {
+	next map[byte]*byteNode
+	ids  []int
+}
+
+func compile(rs []*Rule) *index {
+	ix := &index{
+		rules: rs,
+		hosts: map[string]*pathIndex{},
+		wild:  &labelNode{},
+		any:   newPathIndex(),
+	}
+	for i, r := range rs {
+		switch h := r.Host.(type) {
+		case nil:
+			ix.any.add(i, r.Path)
+		case exact:
+			pi := ix.hosts[string(h)]
+			if pi == nil {
+				pi = newPathIndex()
+				ix.hosts[string(h)] = pi
+			}
+			pi.add(i, r.Path)
+		case wildcard:
+			if dom, ok := wildDomain(string(h)); ok {
+				ix.wild.insert(dom).add(i, r.Path)
+				continue
+			}
+			ix.slow = append(ix.slow, i)
+		default:
+			ix.slow = append(ix.slow, i)
+		}
+	}
+	return ix
+}
+
+// match 返回第一条命中的规则；live 时同时评估 modifiers（会推进计数）
+func (ix *index) match(q *reqInfo, live bool) *Rule {
+	u := q.u
+	var buf [16]int
+	cand := append(buf[:0], ix.slow...)
+	if pi := ix.hosts[u.Host]; pi != nil {
+		cand = pi.lookup(u.Path, cand)
+	}
+	cand = ix.wild.lookup(u.Host, u.Path, cand)
+	cand = ix.any.lookup(u.Path, cand)
+
+	sort.Ints(cand)
+	for _, i := range cand {
+		if r := ix.rules[i]; r.mismatch(q) == "" && (!live || r.allow()) {
+			return r
+		}
+	}
+	return nil
+}
+
+/* ---------- host: "*.domain" 反向 label trie ---------- */
+
+// wildDomain 识别可索引的 "*.a.b"（其余部分不含通配符）
+func wildDomain(p string) (string, bool) {
+	dom, ok := strings.CutPrefix(p, "*.")
+	if !ok || dom == "" || strings.ContainsAny(dom, `*?[\`) {
+		return "", false
+	}
+	return dom, true
+}
+
+func (n *labelNode) insert(dom string) *pathIndex {
+	labels := strings.Split(dom, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		if n.next == nil {
+			n.next = map[string]*labelNode{}
+		}
+		c := n.next[labels[i]]
+		if c == nil {
+			c = &labelNode{}
+			n.next[labels[i]] = c
+		}
+		n = c
+	}
+	if n.paths == nil {
+		n.paths = newPathIndex()
+	}
+	return n.paths
+}
+
+// lookup 从最右 label 向左走；"*.a.b" 要求 host 在 ".a.b" 之前还有内容
+func (n *labelNode) lookup(host, path string, cand []int) []int {
+	rest := host
+	for n != nil && rest != "" {
+		var label string
+		if i := strings.LastIndexByte(rest, '.'); i >= 0 {
+			label, rest = rest[i+1:], rest[:i]
+		} else {
+			return cand // 已到最左 label，"*." 无处可落
+		}
+		if n = n.next[label]; n != nil && n.paths != nil {
+			cand = n.paths.lookup(path, cand)
+		}
+	}
+	return cand
+}
+
+/* ---------- path: exact map + 前缀 trie ---------- */
+
+func newPathIndex() *pathIndex {
+	return &pathIndex{exact: map[string][]int{}, prefix: &byteNode{}}
+}
+
+func (pi *pathIndex) add(i int, m matcher) {
+	switch p := m.(type) {
+	case nil:
+		pi.all = append(pi.all, i)
+	case exact:
+		pi.exact[string(p)] = append(pi.exact[string(p)], i)
+	case prefix:
+		pi.prefix.insert(string(p), i)
+	case regex:
+		if lit := anchoredLiteral(p.Regexp.String()); lit != "" {
+			pi.prefix.insert(lit, i)
+			return
+		}
+		pi.slow = append(pi.slow, i)
+	default:
+		pi.slow = append(pi.slow, i)
+	}
+}
+
+// anchoredLiteral 取 "^literal..." 正则的字面前缀；无法确定时返回 ""
+func anchoredLiteral(expr string) string {
+	t, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil || t.Op != syntax.OpConcat || len(t.Sub) < 2 || t.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+	if l := t.Sub[1]; l.Op == syntax.OpLiteral && l.Flags&syntax.FoldCase == 0 {
+		return string(l.Rune)
+	}
+	return ""
+}
+
+func (n *byteNode) insert(p string, i int) {
+	for j := 0; j < len(p); j++ {
+		if n.next == nil {
+			n.next = map[byte]*byteNode{}
+		}
+		c := n.next[p[j]]
+		if c == nil {
+			c = &byteNode{}
+			n.next[p[j]] = c
+		}
+		n = c
+	}
+	n.ids = append(n.ids, i)
+}
+
+func (pi *pathIndex) lookup(path string, cand []int) []int {
+	cand = append(cand, pi.all...)
+	cand = append(cand, pi.slow...)
+	cand = append(cand, pi.exact[path]...)
+	n := pi.prefix
+	cand = append(cand, n.ids...)
+	for j := 0; j < len(path) && n != nil; j++ {
+		if n = n.next[path[j]]; n != nil {
+			cand = append(cand, n.ids...)
+		}
+	}
+	return cand
+}
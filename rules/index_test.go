@@ -0,0 +1,180 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func parseRules(t testing.TB, lines ...string) []*Rule {
+	t.Helper()
+	rs := make([]*Rule, 0, len(lines))
+	for i, l := range lines {
+		r, err := parseLine(l)
+		if err != nil {
+			t.Fatalf("%s: %v", l, err)
+		}
+		r.File, r.Line, r.Raw = "test", i+1, l
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+func newReq(method, raw string, h http.Header) *reqInfo {
+	u, _ := url.Parse(raw)
+	if h == nil {
+		h = http.Header{}
+	}
+	return &reqInfo{u, method, h}
+}
+
+func TestIndexMatchesLinear(t *testing.T) {
+	rs := parseRules(t,
+		"a.com/api/item status://200",            // 精确 host + 精确 path
+		"a.com/api/* status://201",               // 前缀 path
+		"*.b.com/* status://202",                 // *.domain
+		"*.b.com:8443/* status://203",            // *.domain 带端口
+		"c.com:8080/* status://204",              // 精确 host 带端口
+		`rx://^/static/v1/ status://205`,         // 无 host，^literal 正则 → 前缀 trie
+		"d.com/* status://206 method:POST",       // filter 不通过时继续往后找
+		"d.com/* status://207 header:X-Env=stag", //
+		"d.com/* status://208",                   //
+		"e?.com/x status://209",                  // host 通配不可索引
+		`rx://(?i)^/casefold status://210`,       // 忽略大小写的正则不可索引
+		"f.com/a*b status://211",                 // path 通配不可索引
+		"f.com/* status://212",                   //
+		"/ping status://213",                     // 无 host 的精确 path
+		"a.com status://214",                     // 无 path
+	)
+	cases := []struct {
+		method, url string
+		h           http.Header
+		want        string // 命中规则的 status 参数，"" 表示不命中
+	}{
+		{"GET", "https://a.com/api/item", nil, "200"},
+		{"GET", "https://a.com/api/list", nil, "201"},
+		{"GET", "https://a.com/other", nil, "214"},
+		{"GET", "https://x.b.com/", nil, "202"},
+		{"GET", "https://x.y.b.com/deep", nil, "202"},
+		{"GET", "https://b.com/", nil, ""}, // "*.b.com" 不含 b.com 本身
+		{"GET", "https://x.b.com:8443/", nil, "203"},
+		{"GET", "https://c.com:8080/any", nil, "204"},
+		{"GET", "https://c.com/any", nil, ""},
+		{"GET", "https://z.com/static/v1/app.js", nil, "205"},
+		{"GET", "https://z.com/static/v2/app.js", nil, ""},
+		{"POST", "https://d.com/", nil, "206"},
+		{"GET", "https://d.com/", http.Header{"X-Env": {"stag"}}, "207"},
+		{"GET", "https://d.com/", nil, "208"},
+		{"GET", "https://e1.com/x", nil, "209"},
+		{"GET", "https://z.com/CaseFold/x", nil, "210"},
+		{"GET", "https://f.com/a-b", nil, "211"},
+		{"GET", "https://f.com/a-c", nil, "212"},
+		{"GET", "https://z.com/ping", nil, "213"},
+		{"GET", "https://a.com/ping", nil, "213"}, // 无 host 的规则也参与排序
+		{"GET", "https://nowhere.org/", nil, ""},
+	}
+	ix := compile(rs)
+	for _, c := range cases {
+		q := newReq(c.method, c.url, c.h)
+		lin, got := matchLinear(rs, q), ix.match(q, false)
+		if lin != got {
+			t.Errorf("%s %s: linear %s, indexed %s", c.method, c.url, pos(lin), pos(got))
+		}
+		if name := status(got); name != c.want {
+			t.Errorf("%s %s: matched %q, want %q", c.method, c.url, name, c.want)
+		}
+	}
+}
+
+// matchLinear 逐条扫描，是索引结果的对照
+func matchLinear(rs []*Rule, q *reqInfo) *Rule {
+	for _, r := range rs {
+		if r.mismatch(q) == "" {
+			return r
+		}
+	}
+	return nil
+}
+
+func status(r *Rule) string {
+	if r == nil {
+		return ""
+	}
+	return r.Actions[0].Param
+}
+
+func pos(r *Rule) string {
+	if r == nil {
+		return "<nil>"
+	}
+	return r.Pos()
+}
+
+/* ---------- 线性扫描 vs 编译索引：go test -bench Match ./rules ---------- */
+
+// benchRules 生成 n 条混合规则（精确 / *.domain / 前缀 / 正则）和对应的请求
+func benchRules(b *testing.B, n int) ([]*Rule, []*reqInfo) {
+	lines := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		var pattern string
+		switch i % 20 {
+		case 0:
+			pattern = fmt.Sprintf("rx://^/rx%d/.*\\.json$", i)
+		case 1, 2, 3, 4, 5:
+			pattern = fmt.Sprintf("*.svc%d.example.com/api*", i)
+		case 6, 7, 8, 9, 10, 11, 12:
+			pattern = fmt.Sprintf("host%d.example.com/static/v%d*", i, i)
+		default:
+			pattern = fmt.Sprintf("host%d.example.com/api/item/%d", i, i)
+		}
+		lines = append(lines, pattern+" status://204")
+	}
+	rs := parseRules(b, lines...)
+
+	var qs []*reqInfo
+	for i := 0; i < n; i += n/64 + 1 {
+		for _, s := range []string{
+			fmt.Sprintf("https://a.svc%d.example.com/api/list", i),
+			fmt.Sprintf("https://host%d.example.com/static/v%d/app.js", i, i),
+			fmt.Sprintf("https://host%d.example.com/api/item/%d", i, i),
+			fmt.Sprintf("https://cdn.example.com/rx%d/data.json", i),
+			"https://miss.example.org/nothing/here",
+		} {
+			qs = append(qs, newReq(http.MethodGet, s, nil))
+		}
+	}
+	ix := compile(rs)
+	for _, q := range qs {
+		if a, c := matchLinear(rs, q), ix.match(q, false); a != c {
+			b.Fatalf("index mismatch for %s: linear=%v indexed=%v", q.u, pos(a), pos(c))
+		}
+	}
+	return rs, qs
+}
+
+func BenchmarkMatchLinear(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			rs, qs := benchRules(b, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				matchLinear(rs, qs[i%len(qs)])
+			}
+		})
+	}
+}
+
+func BenchmarkMatchIndexed(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			rs, qs := benchRules(b, n)
+			ix := compile(rs)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ix.match(qs[i%len(qs)], false)
+			}
+		})
+	}
+}
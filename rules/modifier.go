@@ -0,0 +1,191 @@
+package rules
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* ---------- modifiers: 规则在何时生效 ----------
+ *
+ * DSL 与 filter 写在一起：
+ *   pct:30                 命中后按 30% 概率生效
+ *   every:3                每 3 次命中生效一次（第 3、6、9… 次）
+ *   times:5                前 5 次生效，之后失效
+ *   window:09:00-18:00     仅在每天本地时间窗口内生效（可跨零点）
+ * 不生效时继续尝试后面的规则。计数随规则文本在热加载间保留。
+ */
+
+// Modifiers 零值表示总是生效
+type Modifiers struct {
+	Percent float64 // 0 = 不限
+	Every   int
+	Times   int
+	Window  string // "HH:MM-HH:MM"
+
+	from, to int // 窗口的起止分钟
+}
+
+func (m *Modifiers) active() bool {
+	return m.Percent > 0 || m.Every > 1 || m.Times > 0 || m.Window != ""
+}
+
+func isModifier(tok string) bool {
+	kind, _, _ := strings.Cut(tok, ":")
+	switch kind {
+	case "pct", "every", "times", "window":
+		return true
+	}
+	return false
+}
+
+// set 解析一个 modifier token
+func (m *Modifiers) set(tok string) error {
+	kind, arg, _ := strings.Cut(tok, ":")
+	switch kind {
+	case "pct":
+		v, err := strconv.ParseFloat(strings.TrimSuffix(arg, "%"), 64)
+		if err != nil || v <= 0 || v > 100 {
+			return fmt.Errorf("pct: want 0-100, got %q", arg)
+		}
+		m.Percent = v
+	case "every", "times":
+		v, err := strconv.Atoi(arg)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("%s: want a positive integer, got %q", kind, arg)
+		}
+		if kind == "every" {
+			m.Every = v
+		} else {
+			m.Times = v
+		}
+	case "window":
+		return m.setWindow(arg)
+	default:
+		return fmt.Errorf("unknown modifier %q", kind)
+	}
+	return nil
+}
+
+func (m *Modifiers) setWindow(w string) error {
+	a, b, ok := strings.Cut(w, "-")
+	from, err1 := clock(a)
+	to, err2 := clock(b)
+	if !ok || err1 != nil || err2 != nil || from == to {
+		return fmt.Errorf("window: want HH:MM-HH:MM, got %q", w)
+	}
+	m.Window, m.from, m.to = w, from, to
+	return nil
+}
+
+func clock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (m *Modifiers) inWindow(now time.Time) bool {
+	t := now.Hour()*60 + now.Minute()
+	if m.from < m.to {
+		return t >= m.from && t < m.to
+	}
+	return t >= m.from || t < m.to // 跨零点
+}
+
+// tokens 返回 DSL 文本，String / 转换共用
+func (m *Modifiers) tokens() []string {
+	var out []string
+	if m.Percent > 0 {
+		out = append(out, "pct:"+strconv.FormatFloat(m.Percent, 'f', -1, 64))
+	}
+	if m.Every > 1 {
+		out = append(out, "every:"+strconv.Itoa(m.Every))
+	}
+	if m.Times > 0 {
+		out = append(out, "times:"+strconv.Itoa(m.Times))
+	}
+	if m.Window != "" {
+		out = append(out, "window:"+m.Window)
+	}
+	return out
+}
+
+// allow 在 pattern / filter 都通过后调用，会推进计数
+func (r *Rule) allow() bool {
+	m := &r.Mods
+	if !m.active() {
+		return true
+	}
+	c := r.stats
+	if m.Window != "" && !m.inWindow(time.Now()) {
+		return false
+	}
+	if n := c.seen.Add(1); m.Every > 1 && n%int64(m.Every) != 0 {
+		return false
+	}
+	if m.Percent > 0 && m.Percent < 100 && !c.roll(r.Raw, m.Percent) {
+		return false
+	}
+	if m.Times > 0 && c.applied.Add(1) > int64(m.Times) {
+		return false
+	}
+	return true
+}
+
+/* ---------- 随机源：-seed 固定后结果可复现 ---------- */
+
+var (
+	seed   atomic.Uint64
+	chance struct {
+		sync.Mutex
+		rnd *rand.Rand
+	}
+)
+
+// SetSeed 固定随机种子；0 表示每次启动随机
+func SetSeed(n uint64) {
+	seed.Store(n)
+	chance.Lock()
+	chance.rnd = nil
+	chance.Unlock()
+}
+
+// newRand 每条规则一个随机源，种子由全局种子与规则文本决定，互不干扰
+func newRand(key string) *rand.Rand {
+	s := seed.Load()
+	if s == 0 {
+		return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return rand.New(rand.NewPCG(s, h.Sum64()))
+}
+
+func (c *counter) roll(key string, pct float64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rnd == nil {
+		c.rnd = newRand(key)
+	}
+	return c.rnd.Float64()*100 < pct
+}
+
+// Chance 按百分比掷骰，供 action 级概率（如 fault://…,25%）使用，同样受 -seed 控制
+func Chance(pct float64) bool {
+	if pct >= 100 {
+		return true
+	}
+	chance.Lock()
+	defer chance.Unlock()
+	if chance.rnd == nil {
+		chance.rnd = newRand("chance")
+	}
+	return chance.rnd.Float64()*100 < pct
+}
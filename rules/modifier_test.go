@@ -0,0 +1,135 @@
+package rules
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModifierParse(t *testing.T) {
+	cases := []struct {
+		tok, err string
+	}{
+		{"pct:30", ""},
+		{"pct:12.5%", ""},
+		{"pct:0", "pct"},
+		{"pct:101", "pct"},
+		{"every:3", ""},
+		{"every:0", "positive integer"},
+		{"times:x", "positive integer"},
+		{"window:09:00-18:00", ""},
+		{"window:22:00-06:00", ""},
+		{"window:10:00-10:00", "HH:MM-HH:MM"},
+		{"window:9-18", "HH:MM-HH:MM"},
+	}
+	for _, c := range cases {
+		var m Modifiers
+		err := m.set(c.tok)
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: %v", c.tok, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%s: error %v, want %q", c.tok, err, c.err)
+		}
+	}
+
+	r := parseRules(t, "a.com/* status://204 window:22:00-06:00 times:3 pct:12.5 every:2")[0]
+	if got := r.String(); got != "a.com/* status://204 pct:12.5 every:2 times:3 window:22:00-06:00" {
+		t.Errorf("String() = %s", got)
+	}
+}
+
+func TestInWindow(t *testing.T) {
+	at := func(hm string) time.Time {
+		t, _ := time.Parse("15:04", hm)
+		return t
+	}
+	day, night := &Modifiers{}, &Modifiers{}
+	day.setWindow("09:00-18:00")
+	night.setWindow("22:00-06:00")
+	cases := []struct {
+		m    *Modifiers
+		at   string
+		want bool
+	}{
+		{day, "09:00", true},
+		{day, "17:59", true},
+		{day, "18:00", false},
+		{day, "08:59", false},
+		{night, "23:30", true},
+		{night, "00:00", true},
+		{night, "05:59", true},
+		{night, "06:00", false},
+		{night, "12:00", false},
+	}
+	for _, c := range cases {
+		if got := c.m.inWindow(at(c.at)); got != c.want {
+			t.Errorf("%s at %s = %v, want %v", c.m.Window, c.at, got, c.want)
+		}
+	}
+}
+
+// allowSeq 连续调用 n 次 allow
+func allowSeq(r *Rule, n int) []bool {
+	out := make([]bool, n)
+	for i := range out {
+		out[i] = r.allow()
+	}
+	return out
+}
+
+func TestAllow(t *testing.T) {
+	T, F := true, false
+	cases := []struct {
+		mods string
+		want []bool
+	}{
+		{"", []bool{T, T, T}},
+		{"every:3", []bool{F, F, T, F, F, T}},
+		{"times:2", []bool{T, T, F, F}},
+		{"every:2 times:2", []bool{F, T, F, T, F, F}}, // times 只消耗真正生效的次数
+		{"pct:100", []bool{T, T, T}},
+	}
+	for _, c := range cases {
+		r := parseRules(t, strings.TrimSpace("a.com/* status://204 "+c.mods))[0]
+		if got := allowSeq(r, len(c.want)); !slices.Equal(got, c.want) {
+			t.Errorf("%q: %v, want %v", c.mods, got, c.want)
+		}
+	}
+}
+
+func TestAllowSeededPct(t *testing.T) {
+	t.Cleanup(func() { SetSeed(0) })
+	SetSeed(42)
+	const line = "a.com/* status://204 pct:30"
+	a := allowSeq(parseRules(t, line)[0], 200)
+	b := allowSeq(parseRules(t, line)[0], 200)
+	if !slices.Equal(a, b) {
+		t.Error("same seed and rule text gave different sequences")
+	}
+	n := 0
+	for _, ok := range a {
+		if ok {
+			n++
+		}
+	}
+	if n < 30 || n > 90 {
+		t.Errorf("pct:30 applied %d of 200 times", n)
+	}
+	if c := allowSeq(parseRules(t, line+" every:1")[0], 200); slices.Equal(a, c) {
+		t.Error("different rule text shares the random sequence")
+	}
+}
+
+func TestModifierStateSurvivesReload(t *testing.T) {
+	const line = "a.com/* status://204 times:2 every:2"
+	old := parseRules(t, line)
+	allowSeq(old[0], 3) // 第 2 次生效，已消耗 1 次
+
+	cur := parseRules(t, line, "b.com/* status://204 times:2")
+	inheritStats(old, cur)
+	if got := allowSeq(cur[0], 4); !slices.Equal(got, []bool{true, false, false, false}) {
+		t.Errorf("after reload: %v, want the 4th hit to use the last of times:2", got)
+	}
+}
@@ -2,7 +2,11 @@ package rules
 
 import (
 	"bufio"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -23,16 +27,45 @@ const (
 	ActStatus     = "status"
 	ActReqHeader  = "reqHeader"
 	ActRespHeader = "respHeader"
+
+	ActHTMLPrepend = "htmlPrepend"
+	ActHTMLAppend  = "htmlAppend"
+	ActJSPrepend   = "jsPrepend"
+	ActJSAppend    = "jsAppend"
+	ActCSSPrepend  = "cssPrepend"
+	ActCSSAppend   = "cssAppend"
+
+	ActResMerge     = "resMerge"
+	ActReqMerge     = "reqMerge"
+	ActResJSONPatch = "resJsonPatch"
+
+	ActRedirect   = "redirect"
+	ActCORS       = "cors"
+	ActReqCookies = "reqCookies"
+	ActResCookies = "resCookies"
+
+	ActURLParams   = "urlParams"
+	ActMethod      = "method"
+	ActPathReplace = "pathReplace"
+
+	ActFault = "fault"
+	ActAuth  = "auth"
+	ActTLS   = "tls"
+	ActGRPC  = "grpc"
 )
 
 /* ---------- matcher implementations ---------- */
 
-type matcher interface{ Match(string) bool }
+type matcher interface {
+	Match(string) bool
+	String() string // 用于 explain 输出
+}
 
 /* 精确匹配 */
 type exact string
 
 func (e exact) Match(s string) bool { return s == string(e) }
+func (e exact) String() string      { return "exact " + string(e) }
 
 /* 通配符 (* ? 不跨目录) */
 type wildcard string
@@ -41,80 +74,248 @@ func (w wildcard) Match(s string) bool {
 	ok, _ := filepath.Match(string(w), s)
 	return ok
 }
+func (w wildcard) String() string { return "wildcard " + string(w) }
 
 /* 前缀匹配：pattern 以 '*' 结尾且只这一处 '*' */
 type prefix string
 
 func (p prefix) Match(s string) bool { return strings.HasPrefix(s, string(p)) }
+func (p prefix) String() string      { return "prefix " + string(p) + "*" }
 
 /* 正则匹配 rx:// */
 type regex struct{ *regexp.Regexp }
 
 func (r regex) Match(s string) bool { return r.Regexp.MatchString(s) }
+func (r regex) String() string      { return "regexp " + r.Regexp.String() }
 
 /* ---------- Rule ---------- */
 
+// Action 是规则上的一个动作：action://param
+type Action struct {
+	Name  string
+	Param string
+}
+
+func (a Action) String() string { return a.Name + "://" + a.Param }
+
 type Rule struct {
+	Pattern string // 原始 pattern 文本
 	Host    matcher
 	Path    matcher
-	PathRaw string // 原始 Path 文本：判断是否 * 结尾
-	Action  string
-	Param   string
+	PathRaw string    // 原始 Path 文本：判断是否 * 结尾
+	Actions []Action  // 按书写顺序
+	Filters []filter  // 全部通过才算命中
+	Mods    Modifiers // 命中后是否生效
+
+	File string // 来源文件
+	Line int    // 行号
+	Raw  string // 原始规则文本
+
+	stats *counter
+}
+
+// Pos 返回 "file:line"，用于日志 / 诊断
+func (r *Rule) Pos() string { return fmt.Sprintf("%s:%d", r.File, r.Line) }
+
+// Find 返回第一个名为 name 的 action；r 为 nil 时返回 false
+func (r *Rule) Find(name string) (Action, bool) {
+	if r != nil {
+		for _, a := range r.Actions {
+			if a.Name == name {
+				return a, true
+			}
+		}
+	}
+	return Action{}, false
+}
+
+// Params 返回所有名为 name 的 action 参数（按书写顺序）；r 可为 nil
+func (r *Rule) Params(name string) []string {
+	if r == nil {
+		return nil
+	}
+	var ps []string
+	for _, a := range r.Actions {
+		if a.Name == name {
+			ps = append(ps, a.Param)
+		}
+	}
+	return ps
+}
+
+// String 返回规则的规范 DSL 文本：pattern action://... filter...
+func (r *Rule) String() string {
+	parts := []string{r.Pattern}
+	for _, a := range r.Actions {
+		parts = append(parts, a.String())
+	}
+	for _, f := range r.Filters {
+		parts = append(parts, f.String())
+	}
+	parts = append(parts, r.Mods.tokens()...)
+	return strings.Join(parts, " ")
+}
+
+/* ---------- syntax errors ---------- */
+
+// SyntaxError 描述某一行规则的错误
+type SyntaxError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// ErrorList 汇总一个文件内的全部错误
+type ErrorList []*SyntaxError
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
 }
 
 /* ---------- hot-reload cache ---------- */
 
 var (
-	txtFile  = "rules.txt"
-	jsonFile = "rules/rules.json"
+	// 未指定 -rules 时按顺序取第一个存在的文件
+	candidates = []string{"rules.txt", "rules.yaml", "rules.yml", "rules/rules.json"}
 
-	mu   sync.RWMutex
-	list []*Rule
-	mt   time.Time
+	mu     sync.RWMutex
+	file   string // SetFile 指定的规则文件
+	list   []*Rule
+	idx    = compile(nil) // list 的索引形式，随 list 一起替换
+	mt     time.Time
+	loaded string // mt 对应的文件
+
+	watchOnce sync.Once
 )
 
+// SetFile 指定规则文件；.yaml / .yml / .json 为结构化格式，其余按 DSL 解析
+func SetFile(p string) {
+	mu.Lock()
+	file, mt = p, time.Time{}
+	mu.Unlock()
+}
+
+// File 返回当前生效的规则文件
+func File() string {
+	mu.RLock()
+	p := file
+	mu.RUnlock()
+	if p != "" {
+		return p
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c
+		}
+	}
+	return candidates[0]
+}
+
 /* ---------- API: Match ---------- */
 
-func Match(u *url.URL) *Rule {
+func Match(u *url.URL, method string, h http.Header) *Rule {
 	load()
 	mu.RLock()
 	defer mu.RUnlock()
+	r := idx.match(&reqInfo{u, method, h}, true)
+	if r != nil {
+		r.stats.hit(r.Actions)
+	}
+	return r
+}
+
+// Hosts 返回规则中的精确 host（去掉端口、去重），供 MITM 预热证书
+func Hosts() []string {
+	load()
+	mu.RLock()
+	defer mu.RUnlock()
+	seen := map[string]bool{}
+	var out []string
 	for _, r := range list {
-		if r.Host != nil && !r.Host.Match(u.Host) {
+		e, ok := r.Host.(exact)
+		if !ok {
 			continue
 		}
-		if r.Path != nil && !r.Path.Match(u.Path) {
-			continue
+		h := string(e)
+		if hh, _, err := net.SplitHostPort(h); err == nil {
+			h = hh
+		}
+		if h != "" && !seen[h] {
+			seen[h] = true
+			out = append(out, h)
 		}
-		return r
 	}
-	return nil
+	return out
+}
+
+// mismatch 返回未通过的 matcher（"host" / "path" / filter 文本），全部通过返回 ""
+func (r *Rule) mismatch(q *reqInfo) string {
+	if r.Host != nil && !r.Host.Match(q.u.Host) {
+		return "host"
+	}
+	if r.Path != nil && !r.Path.Match(q.u.Path) {
+		return "path"
+	}
+	for _, f := range r.Filters {
+		if !f.ok(q) {
+			return f.String()
+		}
+	}
+	return ""
 }
 
 /* ---------- internal loader ---------- */
 
 func load() {
-	fi, err := os.Stat(txtFile)
+	watchOnce.Do(func() { go watchRules() })
+
+	p := File()
+	fi, err := os.Stat(p)
 	if err != nil {
-		if mt.IsZero() {
-			loadLegacy()
-		}
 		return
 	}
-	if fi.ModTime() == mt {
+	mu.RLock()
+	same := fi.ModTime() == mt && p == loaded
+	mu.RUnlock()
+	if same {
 		return
 	} // no change
 
-	rs, err := parseDSL(txtFile)
+	rs, err := parseFile(p)
 	if err != nil {
-		logx.D("[rules] parse error: %v", err)
+		// 保留上一份可用规则；记录 mtime 避免每个请求都重复解析
+		mu.Lock()
+		mt, loaded = fi.ModTime(), p
+		n := len(list)
+		mu.Unlock()
+		logx.I("[rules] %s rejected, keeping %d previous rule(s):\n%v", p, n, err)
 		return
 	}
 
+	// 计数在锁内取，与实际装入的规则集一致
 	mu.Lock()
-	list, mt = rs, fi.ModTime()
+	install(rs)
+	mt, loaded = fi.ModTime(), p
+	n := len(list)
 	mu.Unlock()
-	logx.D("[rules] %d rule(s) loaded", len(rs))
+	logx.D("[rules] %d rule(s) loaded from %s", n, p)
+}
+
+// install 替换当前规则集（调用方持有 mu）
+func install(rs []*Rule) {
+	inheritStats(list, rs)
+	list, idx = rs, compile(rs)
 }
 
 func parseDSL(p string) ([]*Rule, error) {
@@ -124,37 +325,228 @@ func parseDSL(p string) ([]*Rule, error) {
 	}
 	defer f.Close()
 
-	var out []*Rule
+	var (
+		out  []*Rule
+		errs ErrorList
+		n    int
+	)
 	sc := bufio.NewScanner(f)
 	for sc.Scan() {
+		n++
 		line := strings.TrimSpace(sc.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
+		r, err := parseLine(line)
+		if err != nil {
+			errs = append(errs, &SyntaxError{File: p, Line: n, Msg: err.Error()})
+			continue
+		}
+		r.File, r.Line, r.Raw = p, n, strings.Join(strings.Fields(line), " ")
+		out = append(out, r)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return out, nil
+}
 
-		parts := strings.Fields(line) // split by space / tab
-		if len(parts) < 2 {
+// CheckLine 校验单行 DSL（不含注释），供导入器等生成规则时自检
+func CheckLine(line string) error {
+	_, err := parseLine(strings.TrimSpace(line))
+	return err
+}
+
+// parseLine 解析单行 "pattern action://param [action://param ...] [filter ...]"
+func parseLine(line string) (*Rule, error) {
+	parts := strings.Fields(line) // split by space / tab
+	var (
+		acts []Action
+		fs   []filter
+		mods Modifiers
+	)
+	for _, tok := range parts[1:] {
+		// filter / modifier 的值里也可能有 "://"（header:X=rx://…），先按前缀识别
+		if !isFilter(tok) && !isModifier(tok) && strings.Contains(tok, "://") {
+			name, param := splitProto(tok)
+			acts = append(acts, Action{name, param})
+			continue
+		}
+		if isModifier(tok) {
+			if err := mods.set(tok); err != nil {
+				return nil, err
+			}
 			continue
 		}
+		f, err := parseFilter(tok)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	if len(acts) == 0 {
+		return nil, fmt.Errorf("missing action for pattern %q", parts[0])
+	}
+	r, err := newRule(parts[0], acts, fs)
+	if err != nil {
+		return nil, err
+	}
+	r.Mods = mods
+	return r, nil
+}
+
+// newRule 编译 pattern 并校验 action，DSL 与结构化格式共用
+func newRule(pattern string, acts []Action, fs []filter) (*Rule, error) {
+	if len(acts) == 0 {
+		return nil, fmt.Errorf("no action for pattern %q", pattern)
+	}
+	for _, a := range acts {
+		if err := validateAction(a.Name, a.Param); err != nil {
+			return nil, err
+		}
+	}
 
-		host, path := splitHostPath(parts[0])
-		action, param := splitProto(parts[1])
+	host, path := splitHostPath(pattern)
+	hm, err := compileMatcher(host)
+	if err != nil {
+		return nil, err
+	}
+	pm, err := compileMatcher(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Rule{
+		Pattern: pattern,
+		Host:    hm,
+		Path:    pm,
+		PathRaw: path,
+		Actions: acts,
+		Filters: fs,
+		stats:   &counter{},
+	}, nil
+}
+
+func validateAction(action, param string) error {
+	switch action {
+	case ActMapRemote:
+		u, err := url.Parse(param)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("mapRemote: invalid target URL %q", param)
+		}
+	case ActMapLocal:
+		if param == "" || param == "@" {
+			return fmt.Errorf("mapLocal: empty body / file")
+		}
+	case ActStatus:
+		if code, ok := ParseStatus(param); !ok || code < 100 || code > 599 {
+			return fmt.Errorf("status: invalid status code %q", param)
+		}
+	case ActRedirect:
+		code, loc := ParseRedirect(param)
+		switch code {
+		case 301, 302, 303, 307, 308:
+		default:
+			return fmt.Errorf("redirect: unsupported status %d (want 301/302/303/307/308)", code)
+		}
+		if loc == "" {
+			return fmt.Errorf("redirect: empty Location")
+		}
+	case ActCORS:
+		if param == "" || param == "*" {
+			break
+		}
+		for _, o := range strings.Split(param, ",") {
+			if u, err := url.Parse(o); err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("cors: invalid origin %q (want scheme://host[:port])", o)
+			}
+		}
+	case ActFault:
+		if _, err := ParseFault(param); err != nil {
+			return fmt.Errorf("fault: %v", err)
+		}
+	case ActAuth:
+		if _, _, err := ParseAuth(param); err != nil {
+			return fmt.Errorf("auth: %v", err)
+		}
+	case ActTLS:
+		if _, err := ParseTLS(param); err != nil {
+			return fmt.Errorf("tls: %v", err)
+		}
+	case ActGRPC:
+		if _, err := ParseGRPC(param); err != nil {
+			return fmt.Errorf("grpc: %v", err)
+		}
+	case ActMethod:
+		if !validMethod(param) {
+			return fmt.Errorf("method: invalid method %q", param)
+		}
+	case ActPathReplace:
+		if _, _, err := ParsePathReplace(param); err != nil {
+			return fmt.Errorf("pathReplace: %v", err)
+		}
+	case ActReqHeader, ActRespHeader, ActReqCookies, ActResCookies, ActURLParams:
+		op, k, _ := ParseHeaderParam(param)
+		switch strings.ToLower(op) {
+		case "add", "set":
+			if !strings.Contains(param, "=") {
+				return fmt.Errorf("%s: %q needs Key=Value", action, param)
+			}
+		case "del", "remove":
+		case "":
+			return fmt.Errorf("%s: missing op in %q (want Add:/Set:/Del:)", action, param)
+		default:
+			return fmt.Errorf("%s: unknown op %q", action, op)
+		}
+		if k == "" {
+			return fmt.Errorf("%s: empty name in %q", action, param)
+		}
+	case ActHTMLPrepend, ActHTMLAppend, ActJSPrepend, ActJSAppend, ActCSSPrepend, ActCSSAppend:
+		if param == "" || param == "@" {
+			return fmt.Errorf("%s: empty content / file", action)
+		}
+	case ActResMerge, ActReqMerge:
+		if strings.HasPrefix(param, "@") {
+			return checkFile(action, param)
+		}
+		var v map[string]any
+		if err := json.Unmarshal([]byte(param), &v); err != nil {
+			return fmt.Errorf("%s: param must be a JSON object: %v", action, err)
+		}
+	case ActResJSONPatch:
+		if strings.HasPrefix(param, "@") {
+			return checkFile(action, param)
+		}
+		var ops []struct{ Op, Path string }
+		if err := json.Unmarshal([]byte(param), &ops); err != nil {
+			return fmt.Errorf("%s: param must be a JSON array of ops: %v", action, err)
+		}
+		for i, o := range ops {
+			switch o.Op {
+			case "add", "remove", "replace", "move", "copy", "test":
+			default:
+				return fmt.Errorf("%s: op #%d: unknown op %q", action, i, o.Op)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+	return nil
+}
 
-		out = append(out, &Rule{
-			Host:    compileMatcher(host),
-			Path:    compileMatcher(path),
-			PathRaw: path,
-			Action:  action,
-			Param:   param,
-		})
+func checkFile(action, param string) error {
+	if param == "@" {
+		return fmt.Errorf("%s: empty file name", action)
 	}
-	return out, sc.Err()
+	return nil
 }
 
 /* ---------- matcher helpers ---------- */
 
 func splitHostPath(s string) (host, path string) {
-	if strings.HasPrefix(s, "/") {
+	if strings.HasPrefix(s, "/") || strings.HasPrefix(s, "rx://") {
 		return "", s
 	}
 	if i := strings.IndexByte(s, '/'); i >= 0 {
@@ -170,50 +562,41 @@ func splitProto(s string) (act, param string) {
 	return s, ""
 }
 
-func compileMatcher(p string) matcher {
+func compileMatcher(p string) (matcher, error) {
 	if p == "" {
-		return nil
+		return nil, nil
 	}
 	if strings.HasPrefix(p, "rx://") {
-		return regex{regexp.MustCompile(strings.TrimPrefix(p, "rx://"))}
+		re, err := regexp.Compile(strings.TrimPrefix(p, "rx://"))
+		if err != nil {
+			return nil, fmt.Errorf("bad regexp %q: %v", p, err)
+		}
+		return regex{re}, nil
 	}
 	/* NEW —— 末尾带单个 '*'  → 前缀匹配 */
 	if strings.HasSuffix(p, "*") && strings.Count(p, "*") == 1 {
-		return prefix(strings.TrimSuffix(p, "*"))
+		return prefix(strings.TrimSuffix(p, "*")), nil
 	}
 	if strings.ContainsAny(p, "*?") {
-		return wildcard(p)
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("bad wildcard %q: %v", p, err)
+		}
+		return wildcard(p), nil
 	}
-	return exact(p)
+	return exact(p), nil
 }
 
-/* ---------- legacy JSON fallback ---------- */
-
-func loadLegacy() {
-	data, err := os.ReadFile(jsonFile)
-	if err != nil {
-		return
-	}
-	var raw []struct{ Match, Action, Target string }
-	if json.Unmarshal(data, &raw) != nil {
-		return
-	}
+// Check 校验规则文件，返回规则条数；供 `gw-lite check` 使用
+func Check(p string) (int, error) {
+	rs, err := parseFile(p)
+	return len(rs), err
+}
 
-	var rs []*Rule
-	for _, r := range raw {
-		h, p := splitHostPath(r.Match)
-		rs = append(rs, &Rule{
-			Host:    compileMatcher(h),
-			Path:    compileMatcher(p),
-			PathRaw: p,
-			Action:  r.Action,
-			Param:   r.Target,
-		})
+func parseFile(p string) ([]*Rule, error) {
+	if isStructured(p) {
+		return parseStructured(p)
 	}
-	mu.Lock()
-	list = rs
-	mu.Unlock()
-	logx.D("[rules] %d legacy JSON rule(s) loaded", len(rs))
+	return parseDSL(p)
 }
 
 /* ---------- helpers for status / header rules ---------- */
@@ -223,6 +606,164 @@ func ParseStatus(s string) (int, bool) {
 	return n, err == nil
 }
 
+// ParseRedirect 解析 [code:]location，缺省 302
+func ParseRedirect(p string) (code int, loc string) {
+	if i := strings.IndexByte(p, ':'); i == 3 {
+		if n, err := strconv.Atoi(p[:3]); err == nil {
+			return n, p[4:]
+		}
+	}
+	return http.StatusFound, p
+}
+
+// ParsePathReplace 解析 regex=replacement（按第一个 '=' 切分，正则里的 '=' 写作 \x3d）
+func ParsePathReplace(p string) (*regexp.Regexp, string, error) {
+	pat, repl, ok := strings.Cut(p, "=")
+	if !ok || pat == "" {
+		return nil, "", fmt.Errorf("%q needs regex=replacement", p)
+	}
+	re, err := regexp.Compile(pat)
+	if err != nil {
+		return nil, "", err
+	}
+	return re, repl, nil
+}
+
+// Fault 故障注入：kind[:N][,P%]
+type Fault struct {
+	Kind    string  // reset | hang | truncate | badchunk
+	N       int     // truncate：截断前发送的 body 字节数
+	Percent float64 // 命中后按概率生效，默认 100
+}
+
+func ParseFault(p string) (Fault, error) {
+	f := Fault{Percent: 100}
+	spec, pct, hasPct := strings.Cut(p, ",")
+	if hasPct {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(pct, "%"), 64)
+		if err != nil || v <= 0 || v > 100 {
+			return f, fmt.Errorf("invalid percentage %q (want 0-100%%)", pct)
+		}
+		f.Percent = v
+	}
+	kind, n, hasN := strings.Cut(spec, ":")
+	f.Kind = kind
+	switch kind {
+	case "reset", "hang", "badchunk":
+		if hasN {
+			return f, fmt.Errorf("%s takes no argument", kind)
+		}
+	case "truncate":
+		v, err := strconv.Atoi(n)
+		if err != nil || v < 0 {
+			return f, fmt.Errorf("truncate needs a byte count, e.g. truncate:1024")
+		}
+		f.N = v
+	default:
+		return f, fmt.Errorf("unknown fault %q (want reset / hang / truncate:N / badchunk)", kind)
+	}
+	return f, nil
+}
+
+// AfterUpstream 报告故障是否需要上游响应（截断 / 坏 chunk 基于真实 body）
+func (f Fault) AfterUpstream() bool { return f.Kind == "truncate" || f.Kind == "badchunk" }
+
+// ParseAuth 解析 basic:<cred> / bearer:<cred> / strip；
+// cred 可为内联值、@file（变更后重新读取）或 $ENV
+func ParseAuth(p string) (scheme, cred string, err error) {
+	scheme, cred, _ = strings.Cut(p, ":")
+	switch scheme = strings.ToLower(scheme); scheme {
+	case "strip":
+		if cred != "" {
+			return "", "", fmt.Errorf("strip takes no argument")
+		}
+		return scheme, "", nil
+	case "basic", "bearer":
+	default:
+		return "", "", fmt.Errorf("unknown scheme %q (want basic:, bearer: or strip)", scheme)
+	}
+	switch {
+	case cred == "", cred == "@", cred == "$":
+		return "", "", fmt.Errorf("%s: empty credentials", scheme)
+	case scheme == "basic" && !strings.HasPrefix(cred, "@") && !strings.HasPrefix(cred, "$") && !strings.Contains(cred, ":"):
+		return "", "", fmt.Errorf("basic: want user:password")
+	}
+	return scheme, cred, nil
+}
+
+// TLSOptions 是 tls:// 的上游 TLS 设置，多个 tls:// 依次叠加：
+// verify | insecure、ca=@bundle.pem、pin=sha256/<base64>、
+// cert=@client.pem[,key=@client.key]、p12=@client.p12[,pass=<pwd|$ENV>]
+type TLSOptions struct {
+	Mode     string // "" = 沿用全局，"verify" / "insecure"
+	CAFile   string
+	Pins     []string // SPKI SHA-256，base64
+	CertFile string
+	KeyFile  string
+	P12File  string
+	P12Pass  string
+}
+
+func ParseTLS(params ...string) (TLSOptions, error) {
+	var o TLSOptions
+	for _, p := range params {
+		for _, item := range strings.Split(p, ",") {
+			k, v, _ := strings.Cut(item, "=")
+			file := strings.TrimPrefix(v, "@")
+			switch k {
+			case "verify", "insecure":
+				o.Mode = k
+				continue
+			case "pin":
+				pin, ok := strings.CutPrefix(v, "sha256/")
+				if b, err := base64.StdEncoding.DecodeString(pin); !ok || err != nil || len(b) != 32 {
+					return o, fmt.Errorf("pin: want sha256/<base64 of 32 bytes>, got %q", v)
+				}
+				o.Pins = append(o.Pins, pin)
+				continue
+			case "pass":
+				o.P12Pass = v
+				continue
+			case "ca", "cert", "key", "p12":
+				if !strings.HasPrefix(v, "@") || file == "" {
+					return o, fmt.Errorf("%s: want @file, got %q", k, v)
+				}
+			default:
+				return o, fmt.Errorf("unknown option %q (want verify, insecure, ca=, pin=, cert=, key=, p12=, pass=)", item)
+			}
+			switch k {
+			case "ca":
+				o.CAFile = file
+			case "cert":
+				o.CertFile = file
+			case "key":
+				o.KeyFile = file
+			case "p12":
+				o.P12File = file
+			}
+		}
+	}
+	if o.P12File != "" && o.CertFile != "" {
+		return o, fmt.Errorf("use either cert= or p12=, not both")
+	}
+	if o.KeyFile != "" && o.CertFile == "" {
+		return o, fmt.Errorf("key= needs cert=")
+	}
+	return o, nil
+}
+
+func validMethod(m string) bool {
+	if m == "" {
+		return false
+	}
+	for _, c := range strings.ToUpper(m) {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
 func ParseHeaderParam(p string) (op, key, val string) {
 	i := strings.IndexByte(p, ':')
 	if i < 0 {
@@ -0,0 +1,140 @@
+package rules
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateAction(t *testing.T) {
+	cases := []struct {
+		action, param string
+		err           string // 为空表示合法
+	}{
+		{ActMapRemote, "https://b.com/x", ""},
+		{ActMapRemote, "b.com/x", "invalid target URL"},
+		{ActMapLocal, "hello", ""},
+		{ActMapLocal, "@", "empty"},
+		{ActStatus, "204", ""},
+		{ActStatus, "99", "invalid status"},
+		{ActStatus, "abc", "invalid status"},
+		{ActRedirect, "https://b.com/", ""},
+		{ActRedirect, "301:https://b.com/", ""},
+		{ActRedirect, "305:https://b.com/", "unsupported status 305"},
+		{ActRedirect, "307:", "empty Location"},
+		{ActCORS, "", ""},
+		{ActCORS, "https://a.com,http://b.com:8080", ""},
+		{ActCORS, "a.com", "invalid origin"},
+		{ActFault, "truncate:10,50%", ""},
+		{ActFault, "reset:1", "takes no argument"},
+		{ActFault, "hang,0%", "invalid percentage"},
+		{ActAuth, "basic:u:p", ""},
+		{ActAuth, "bearer:$TOKEN", ""},
+		{ActAuth, "basic:nopass", "user:password"},
+		{ActAuth, "digest:x", "unknown scheme"},
+		{ActTLS, "verify,ca=@ca.pem", ""},
+		{ActTLS, "ca=ca.pem", "want @file"},
+		{ActTLS, "cert=@a.pem,p12=@b.p12", "either cert= or p12="},
+		{ActGRPC, "status=5", ""},
+		{ActMethod, "PATCH", ""},
+		{ActMethod, "GET POST", "invalid method"},
+		{ActPathReplace, `^/v1/(.*)=/v2/$1`, ""},
+		{ActPathReplace, "(=x", "error parsing regexp"},
+		{ActReqHeader, "Set:X-A=1", ""},
+		{ActReqHeader, "Del:Cookie", ""},
+		{ActRespHeader, "Set:X-A", "needs Key=Value"},
+		{ActReqCookies, "X-A=1", "missing op"},
+		{ActResCookies, "Put:a=1", "unknown op"},
+		{ActURLParams, "Del:", "empty name"},
+		{ActJSAppend, "@inject.js", ""},
+		{ActCSSPrepend, "", "empty content"},
+		{ActResMerge, `{"a":1}`, ""},
+		{ActReqMerge, `[1]`, "JSON object"},
+		{ActResMerge, "@", "empty file name"},
+		{ActResJSONPatch, `[{"op":"add","path":"/a","value":1}]`, ""},
+		{ActResJSONPatch, `[{"op":"frob","path":"/a"}]`, `unknown op "frob"`},
+		{ActResJSONPatch, `{"op":"add"}`, "JSON array"},
+		{"nope", "x", `unknown action "nope"`},
+	}
+	for _, c := range cases {
+		err := validateAction(c.action, c.param)
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s://%s: %v", c.action, c.param, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%s://%s: error %v, want %q", c.action, c.param, err, c.err)
+		}
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	cases := []struct {
+		line string
+		err  string
+		host string // matcher.String()，"" 表示无
+		path string
+	}{
+		{line: "a.com/api/* status://204", host: "exact a.com", path: "prefix /api/*"},
+		{line: "*.a.com/x status://204", host: "wildcard *.a.com", path: "exact /x"},
+		{line: "/health status://204", path: "exact /health"},
+		{line: `rx://^/v\d+/ status://204`, path: `regexp ^/v\d+/`},
+		{line: "a.com:8443 status://204", host: "exact a.com:8443"},
+		{line: "a.com/*", err: "missing action"},
+		{line: "a.com/* method:GET", err: "missing action"},
+		{line: "a.com/x[*y status://204", err: "bad wildcard"},
+		{line: "rx://( status://204", err: "bad regexp"},
+		{line: "a.com/* status://204 bogus", err: "bogus"},
+		{line: "a.com/* status://204 pct:200", err: "pct"},
+		{line: "a.com/* status://204 header:=x", err: "header"},
+	}
+	str := func(m matcher) string {
+		if m == nil {
+			return ""
+		}
+		return m.String()
+	}
+	for _, c := range cases {
+		r, err := parseLine(c.line)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: error %v, want %q", c.line, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.line, err)
+			continue
+		}
+		if str(r.Host) != c.host || str(r.Path) != c.path {
+			t.Errorf("%s: host %q path %q, want %q %q", c.line, str(r.Host), str(r.Path), c.host, c.path)
+		}
+	}
+}
+
+func TestCheckReportsEveryLine(t *testing.T) {
+	p := writeFile(t, "rules.txt", `# comment
+a.com/* status://204
+
+b.com/* status://999
+c.com/*   mapRemote://https://d.com/   reqHeader://Set:X=1
+d.com/* nope://x
+`)
+	_, err := Check(p)
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 2 {
+		t.Fatalf("Check = %v, want 2 errors", err)
+	}
+	for i, want := range []int{4, 6} {
+		if list[i].File != p || list[i].Line != want {
+			t.Errorf("error %d at %s:%d, want line %d", i, list[i].File, list[i].Line, want)
+		}
+	}
+
+	rs, err := parseFile(writeFile(t, "ok.txt", "a.com/* status://204\n\n  c.com/*   mapRemote://https://d.com/\treqHeader://Set:X=1\n"))
+	if err != nil || len(rs) != 2 {
+		t.Fatalf("parseFile = %d rules, %v", len(rs), err)
+	}
+	if r := rs[1]; r.Line != 3 || r.Raw != "c.com/* mapRemote://https://d.com/ reqHeader://Set:X=1" {
+		t.Errorf("rule 2 = line %d %q", r.Line, r.Raw)
+	}
+}
@@ -0,0 +1,128 @@
+package rules
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+)
+
+/* ---------- per-rule hit counters ---------- */
+
+// counter 挂在 Rule 上；热加载时按规则文本迁移到新 Rule
+type counter struct {
+	hits atomic.Int64
+	last atomic.Int64 // unix nano
+
+	mu      sync.Mutex
+	actions map[string]int64
+
+	// modifiers 的状态
+	seen    atomic.Int64 // 通过 pattern / filter 的次数
+	applied atomic.Int64 // times:N 已消耗的次数
+	rnd     *rand.Rand   // pct:N，受 mu 保护
+}
+
+func (c *counter) hit(acts []Action) {
+	c.hits.Add(1)
+	c.last.Store(time.Now().UnixNano())
+	c.mu.Lock()
+	if c.actions == nil {
+		c.actions = map[string]int64{}
+	}
+	for _, a := range acts {
+		c.actions[a.Name]++
+	}
+	c.mu.Unlock()
+}
+
+// RuleStats 是某条规则的计数快照
+type RuleStats struct {
+	Pos     string           `json:"pos"`
+	Rule    string           `json:"rule"`
+	Hits    int64            `json:"hits"`
+	Actions map[string]int64 `json:"actions,omitempty"`
+	LastHit *time.Time       `json:"last_hit,omitempty"`
+}
+
+// Stats 返回当前规则集的计数快照（按规则顺序）
+func Stats() []RuleStats {
+	load()
+	mu.RLock()
+	defer mu.RUnlock()
+
+	out := make([]RuleStats, 0, len(list))
+	for _, r := range list {
+		s := RuleStats{Pos: r.Pos(), Rule: r.Raw, Hits: r.stats.hits.Load()}
+		if ns := r.stats.last.Load(); ns != 0 {
+			t := time.Unix(0, ns)
+			s.LastHit = &t
+		}
+		r.stats.mu.Lock()
+		if len(r.stats.actions) > 0 {
+			s.Actions = make(map[string]int64, len(r.stats.actions))
+			for k, v := range r.stats.actions {
+				s.Actions[k] = v
+			}
+		}
+		r.stats.mu.Unlock()
+		out = append(out, s)
+	}
+	return out
+}
+
+// inheritStats 让文本未变的新规则沿用旧计数；重复文本按出现顺序一一对应
+func inheritStats(old, cur []*Rule) {
+	pool := map[string][]*counter{}
+	for _, r := range old {
+		pool[r.Raw] = append(pool[r.Raw], r.stats)
+	}
+	for _, r := range cur {
+		if cs := pool[r.Raw]; len(cs) > 0 {
+			r.stats, pool[r.Raw] = cs[0], cs[1:]
+		}
+	}
+}
+
+// LogStats 每隔 every 打印一次命中汇总；every <= 0 时不启动
+func LogStats(every time.Duration) {
+	if every <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(every) {
+			logx.I("[stats] %s", summary(Stats()))
+		}
+	}()
+}
+
+func summary(ss []RuleStats) string {
+	var dead []string
+	hot := make([]RuleStats, 0, len(ss))
+	for _, s := range ss {
+		if s.Hits == 0 {
+			dead = append(dead, s.Pos)
+			continue
+		}
+		hot = append(hot, s)
+	}
+	sort.SliceStable(hot, func(i, j int) bool { return hot[i].Hits > hot[j].Hits })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d rule(s), %d hit, %d never hit", len(ss), len(hot), len(dead))
+	for i, s := range hot {
+		if i == 5 {
+			break
+		}
+		fmt.Fprintf(&b, "\n  %6d  %-20s %s", s.Hits, s.Pos, s.Rule)
+	}
+	if len(dead) > 0 {
+		fmt.Fprintf(&b, "\n  never hit: %s", strings.Join(dead, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package rules
+
+import (
+	"net/url"
+	"os"
+	"testing"
+)
+
+// useRules 写入 content 并设为当前规则文件（SetFile 会强制下次 Match 重新加载）
+func useRules(t *testing.T, p, content string) {
+	t.Helper()
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	SetFile(p)
+}
+
+func hits(t *testing.T) map[string]int64 {
+	t.Helper()
+	m := map[string]int64{}
+	for _, s := range Stats() {
+		m[s.Rule] += s.Hits
+	}
+	return m
+}
+
+func TestStatsSurviveReload(t *testing.T) {
+	p := writeFile(t, "rules.txt", "")
+	t.Cleanup(func() { SetFile("") })
+	get := func(raw string) {
+		u, _ := url.Parse(raw)
+		Match(u, "GET", nil)
+	}
+
+	useRules(t, p, "a.com/* status://204\nb.com/* status://204 respHeader://Set:X=1\n")
+	get("https://a.com/1")
+	get("https://a.com/2")
+	get("https://b.com/")
+	if h := hits(t); h["a.com/* status://204"] != 2 || h["b.com/* status://204 respHeader://Set:X=1"] != 1 {
+		t.Fatalf("hits = %v", h)
+	}
+
+	// a.com 不变（换了行号与空白）→ 保留；b.com 改了 → 归零；新增 c.com
+	useRules(t, p, "c.com/* status://204\n\na.com/*    status://204\nb.com/* status://205\n")
+	h := hits(t)
+	if h["a.com/* status://204"] != 2 || h["b.com/* status://205"] != 0 || h["c.com/* status://204"] != 0 {
+		t.Errorf("after reload hits = %v", h)
+	}
+	for _, s := range Stats() {
+		if s.Rule == "a.com/* status://204" && (s.Pos != p+":3" || s.LastHit == nil || s.Actions["status"] != 2) {
+			t.Errorf("carried stats = %+v", s)
+		}
+	}
+
+	// 文件出错时保留上一份规则和计数
+	useRules(t, p, "a.com/* status://999\n")
+	get("https://a.com/3")
+	if h := hits(t); h["a.com/* status://204"] != 3 {
+		t.Errorf("after a rejected reload hits = %v", h)
+	}
+}
+
+func TestInheritStatsDuplicates(t *testing.T) {
+	old := parseRules(t, "a.com/* status://204", "a.com/* status://204", "b.com/* status://204")
+	for i, r := range old {
+		r.stats.hits.Store(int64(i + 1))
+	}
+	cur := parseRules(t, "a.com/* status://204", "b.com/* status://204", "a.com/* status://204", "a.com/* status://204")
+	inheritStats(old, cur)
+	// 重复文本按出现顺序一一对应，多出来的一条从零开始
+	for i, want := range []int64{1, 3, 2, 0} {
+		if got := cur[i].stats.hits.Load(); got != want {
+			t.Errorf("rule %d hits = %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	got := summary([]RuleStats{
+		{Pos: "r:1", Rule: "a", Hits: 1},
+		{Pos: "r:2", Rule: "b"},
+		{Pos: "r:3", Rule: "c", Hits: 5},
+	})
+	want := "3 rule(s), 2 hit, 1 never hit" +
+		"\n       5  r:3                  c" +
+		"\n       1  r:1                  a" +
+		"\n  never hit: r:2"
+	if got != want {
+		t.Errorf("summary =\n%s\nwant\n%s", got, want)
+	}
+}
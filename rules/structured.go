@@ -0,0 +1,283 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/* ---------- structured rules (YAML / JSON) ----------
+ *
+ *   - match: www.tiktok.com/static*
+ *     method: [GET, POST]
+ *     headers: {X-Env: staging}      # 值为空 = 只要求存在
+ *     query: {debug: "1"}
+ *     grpc: helloworld.Greeter/*    # gRPC 方法，同 DSL 的 grpc:
+ *     actions:
+ *       - {action: mapRemote, param: https://google.com}
+ *       - {action: respHeader, param: "Set:X-Mock=1"}
+ *     pct: 30                        # modifiers，含义同 DSL
+ *     window: "09:00-18:00"
+ *
+ * 旧 rules.json 的 {match, action, target} 单 action 写法仍然有效。
+ */
+
+// Spec 是结构化格式中的一条规则
+type Spec struct {
+	Match   string            `yaml:"match" json:"match"`
+	Method  []string          `yaml:"method,omitempty" json:"method,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Query   map[string]string `yaml:"query,omitempty" json:"query,omitempty"`
+	GRPC    string            `yaml:"grpc,omitempty" json:"grpc,omitempty"`
+	Actions []ActionSpec      `yaml:"actions,omitempty" json:"actions,omitempty"`
+
+	Pct    float64 `yaml:"pct,omitempty" json:"pct,omitempty"`
+	Every  int     `yaml:"every,omitempty" json:"every,omitempty"`
+	Times  int     `yaml:"times,omitempty" json:"times,omitempty"`
+	Window string  `yaml:"window,omitempty" json:"window,omitempty"`
+
+	// 旧 rules.json 写法
+	Action string `yaml:"action,omitempty" json:"action,omitempty"`
+	Target string `yaml:"target,omitempty" json:"target,omitempty"`
+}
+
+type ActionSpec struct {
+	Action string `yaml:"action" json:"action"`
+	Param  string `yaml:"param" json:"param"`
+}
+
+func isStructured(p string) bool {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// parseStructured 解析 YAML / JSON（JSON 按 YAML 子集解析，以便拿到行号）
+func parseStructured(p string) ([]*Rule, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, ErrorList{{File: p, Msg: err.Error()}}
+	}
+	if len(root.Content) == 0 {
+		return nil, nil // 空文件
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.SequenceNode {
+		return nil, ErrorList{{File: p, Line: doc.Line, Msg: "top level must be a list of rules"}}
+	}
+
+	var (
+		rs   []*Rule
+		errs ErrorList
+	)
+	for _, n := range doc.Content {
+		var sp Spec
+		err := n.Decode(&sp)
+		var r *Rule
+		if err == nil {
+			r, err = sp.rule()
+		}
+		if err != nil {
+			errs = append(errs, &SyntaxError{File: p, Line: n.Line, Msg: err.Error()})
+			continue
+		}
+		r.File, r.Line, r.Raw = p, n.Line, r.String()
+		rs = append(rs, r)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return rs, nil
+}
+
+func (sp *Spec) rule() (*Rule, error) {
+	// 去掉 scheme，与 DSL 的 host/path 写法对齐
+	m := sp.Match
+	if j := strings.Index(m, "://"); j >= 0 && !strings.HasPrefix(m, "rx://") {
+		m = m[j+3:]
+	}
+	if m == "" {
+		return nil, fmt.Errorf("missing match")
+	}
+
+	var acts []Action
+	for _, a := range sp.Actions {
+		acts = append(acts, Action{a.Action, a.Param})
+	}
+	if sp.Action != "" {
+		acts = append(acts, Action{sp.Action, sp.Target})
+	}
+
+	var fs []filter
+	if len(sp.Method) > 0 {
+		f, err := newMethodFilter(sp.Method)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	for _, kv := range []struct {
+		kind string
+		m    map[string]string
+	}{{"header", sp.Headers}, {"query", sp.Query}} {
+		for _, k := range sortedKeys(kv.m) {
+			var val *string
+			if v := kv.m[k]; v != "" {
+				val = &v
+			}
+			f, err := newKVFilter(kv.kind, k, val)
+			if err != nil {
+				return nil, err
+			}
+			fs = append(fs, f)
+		}
+	}
+	if sp.GRPC != "" {
+		f, err := newGRPCFilter(sp.GRPC)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	r, err := newRule(m, acts, fs)
+	if err != nil {
+		return nil, err
+	}
+	for _, tok := range sp.modTokens() {
+		if err := r.Mods.set(tok); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (sp *Spec) modTokens() []string {
+	var out []string
+	if sp.Pct != 0 {
+		out = append(out, "pct:"+strconv.FormatFloat(sp.Pct, 'f', -1, 64))
+	}
+	if sp.Every != 0 {
+		out = append(out, "every:"+strconv.Itoa(sp.Every))
+	}
+	if sp.Times != 0 {
+		out = append(out, "times:"+strconv.Itoa(sp.Times))
+	}
+	if sp.Window != "" {
+		out = append(out, "window:"+sp.Window)
+	}
+	return out
+}
+
+// spec 是 rule() 的逆过程，用于格式转换
+func (r *Rule) spec() Spec {
+	sp := Spec{Match: r.Pattern, Pct: r.Mods.Percent, Times: r.Mods.Times, Window: r.Mods.Window}
+	if r.Mods.Every > 1 {
+		sp.Every = r.Mods.Every
+	}
+	for _, a := range r.Actions {
+		sp.Actions = append(sp.Actions, ActionSpec{a.Name, a.Param})
+	}
+	for _, f := range r.Filters {
+		switch f := f.(type) {
+		case methodFilter:
+			sp.Method = append(sp.Method, f...)
+		case *kvFilter:
+			m := &sp.Headers
+			if f.kind == "query" {
+				m = &sp.Query
+			}
+			if *m == nil {
+				*m = map[string]string{}
+			}
+			(*m)[f.key] = f.raw
+		case grpcFilter:
+			sp.GRPC = f.raw
+		}
+	}
+	return sp
+}
+
+/* ---------- conversion ---------- */
+
+// Convert 把任意格式的规则文件转换为 format（"txt" / "yaml" / "json"）
+func Convert(p, format string) ([]byte, error) {
+	rs, err := parseFile(p)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "txt", "dsl":
+		var b bytes.Buffer
+		for _, r := range rs {
+			if err := dslSafe(r); err != nil {
+				return nil, fmt.Errorf("%s: %v", r.Pos(), err)
+			}
+			b.WriteString(r.String())
+			b.WriteByte('\n')
+		}
+		return b.Bytes(), nil
+	case "yaml", "yml":
+		return yaml.Marshal(specs(rs))
+	case "json":
+		b, err := json.MarshalIndent(specs(rs), "", "  ")
+		return append(b, '\n'), err
+	}
+	return nil, fmt.Errorf("unknown format %q (want txt, yaml or json)", format)
+}
+
+func specs(rs []*Rule) []Spec {
+	out := make([]Spec, len(rs))
+	for i, r := range rs {
+		out[i] = r.spec()
+	}
+	return out
+}
+
+// dslSafe DSL 以空白分隔，带空白的 pattern / 参数无法表示；其余情况按 DSL 重新解析，结果须与原规则一致
+func dslSafe(r *Rule) error {
+	for _, a := range r.Actions {
+		if strings.ContainsAny(a.Param, " \t\r\n") {
+			return fmt.Errorf("%s param contains whitespace, not expressible in DSL", a.Name)
+		}
+	}
+	for _, f := range r.Filters {
+		if strings.ContainsAny(f.String(), " \t\r\n") {
+			return fmt.Errorf("filter %q contains whitespace, not expressible in DSL", f)
+		}
+	}
+	if strings.ContainsAny(r.Pattern, " \t\r\n") {
+		return fmt.Errorf("pattern contains whitespace, not expressible in DSL")
+	}
+	line := r.String()
+	back, err := parseLine(line)
+	if err != nil {
+		return fmt.Errorf("not expressible in DSL: %v", err)
+	}
+	if !reflect.DeepEqual(back.spec(), r.spec()) { // 文本相同也可能含义不同：header:A=B=x
+		return fmt.Errorf("does not survive a DSL round trip: %q", line)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
@@ -0,0 +1,138 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string // YAML 转回 DSL 后的规范文本（filter 按 method / header / query / grpc 排序）
+	}{
+		{"plain", "a.com/* mapRemote://http://b.com/", ""},
+		{"multiple actions", "a.com/api* respHeader://Set:X-Mock=1 reqHeader://Del:Cookie", ""},
+		{"method action vs filter", "a.com/ping method://POST method:GET", ""},
+		{"regexp header value", "a.com/* status://403 header:X-Env=rx://^stag", ""},
+		{"regexp query value", "a.com/* status://403 query:k=rx://^v[0-9]+$", ""},
+		{"grpc regexp", `a.com/* grpc://status=5 grpc:rx://^demo\.Greeter/`, ""},
+		{"filter order", "a.com/* status://204 query:debug header:X-A method:GET,POST",
+			"a.com/* status://204 method:GET,POST header:X-A query:debug"},
+		{"modifiers", "a.com/* fault://reset,25% pct:10 times:3 window:22:00-06:00", ""},
+		{"regexp pattern", `rx://^/api/.*\.json$ respHeader://Del:Cache-Control`, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			want := c.want
+			if want == "" {
+				want = c.in
+			}
+			dsl := writeFile(t, "rules.txt", c.in+"\n")
+			if _, err := Check(dsl); err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			y, err := Convert(dsl, "yaml")
+			if err != nil {
+				t.Fatalf("to yaml: %v", err)
+			}
+			back, err := Convert(writeFile(t, "rules.yaml", string(y)), "txt")
+			if err != nil {
+				t.Fatalf("to txt: %v\n%s", err, y)
+			}
+			if got := strings.TrimSpace(string(back)); got != want {
+				t.Errorf("round trip\n got %s\nwant %s\nyaml:\n%s", got, want, y)
+			}
+			if _, err := Check(writeFile(t, "back.txt", string(back))); err != nil {
+				t.Errorf("converted DSL does not check: %v", err)
+			}
+		})
+	}
+}
+
+func TestConvertRejectsLossyDSL(t *testing.T) {
+	cases := map[string]string{
+		"whitespace in param": "- match: a.com/*\n  actions: [{action: mapLocal, param: \"hello world\"}]\n",
+		"'=' in header name":  "- match: a.com/*\n  headers: {\"A=B\": x}\n  actions: [{action: status, param: \"204\"}]\n",
+	}
+	for name, y := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := writeFile(t, "rules.yaml", y)
+			if _, err := Check(p); err != nil {
+				t.Fatalf("yaml should be valid: %v", err)
+			}
+			if out, err := Convert(p, "txt"); err == nil {
+				t.Errorf("expected an error, got DSL %q", out)
+			}
+		})
+	}
+}
+
+func TestParseStructured(t *testing.T) {
+	p := writeFile(t, "rules.yaml", `- match: https://a.com/api*
+  method: [get, POST]
+  headers: {X-Env: stag, X-Any: ""}
+  query: {debug: "1"}
+  actions:
+    - {action: status, param: "204"}
+  times: 2
+- match: b.com/*
+  action: mapRemote
+  target: https://c.com/
+`)
+	rs, err := parseFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		line int
+		raw  string
+	}{
+		{1, "a.com/api* status://204 method:GET,POST header:X-Any header:X-Env=stag query:debug=1 times:2"},
+		{8, "b.com/* mapRemote://https://c.com/"},
+	}
+	if len(rs) != len(want) {
+		t.Fatalf("%d rules, want %d", len(rs), len(want))
+	}
+	for i, w := range want {
+		if rs[i].Line != w.line || rs[i].Raw != w.raw {
+			t.Errorf("rule %d = line %d %q, want line %d %q", i, rs[i].Line, rs[i].Raw, w.line, w.raw)
+		}
+	}
+
+	cases := []struct {
+		name, in string
+		lines    []int
+		msg      string
+	}{
+		{"not a list", "match: a.com\n", []int{1}, "list of rules"},
+		{"bad yaml", "- match: [a\n", []int{0}, "yaml"},
+		{"per rule errors", "- match: a.com/*\n  actions: [{action: status, param: '204'}]\n- match: ''\n  action: status\n  target: '204'\n- match: b.com/*\n  actions: [{action: nope, param: x}]\n", []int{3, 6}, ""},
+		{"bad modifier", "- match: a.com/*\n  action: status\n  target: '204'\n  pct: 200\n", []int{1}, "pct"},
+		{"bad method", "- match: a.com/*\n  action: status\n  target: '204'\n  method: ['G T']\n", []int{1}, "method"},
+	}
+	for _, c := range cases {
+		_, err := parseFile(writeFile(t, "rules.yaml", c.in))
+		list, ok := err.(ErrorList)
+		if !ok || len(list) != len(c.lines) {
+			t.Errorf("%s: error %v, want %d error(s)", c.name, err, len(c.lines))
+			continue
+		}
+		for i, e := range list {
+			if e.Line != c.lines[i] || !strings.Contains(e.Msg, c.msg) {
+				t.Errorf("%s: error %d = line %d %q, want line %d containing %q", c.name, i, e.Line, e.Msg, c.lines[i], c.msg)
+			}
+		}
+	}
+}
@@ -1,14 +1,13 @@
 package rules
 
 import (
-	"time"
+	"path/filepath"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/sonacy/go-whistle-lite/internal/logx"
 )
 
-func init() { go watchRules() }
-
+// watchRules 监听规则文件所在目录（编辑器常以 rename 方式保存，直接监听文件会丢事件）
 func watchRules() {
 	w, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -17,17 +16,35 @@ func watchRules() {
 	}
 	defer w.Close()
 
-	_ = w.Add(txtFile) // 监听 rules.txt
+	dirs := map[string]bool{}
+	for _, p := range append(candidates, File()) {
+		dirs[filepath.Dir(p)] = true
+	}
+	for d := range dirs {
+		_ = w.Add(d)
+	}
+
 	for {
 		select {
 		case ev := <-w.Events:
-			if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
-				logx.D("[watch] %s changed, reloading", txtFile)
-				// 只需把 mtime 置零，下次 Match 会强制重新解析
-				mt = time.Time{}
+			if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 || !isRuleFile(ev.Name) {
+				continue
 			}
+			logx.D("[watch] %s changed, reloading", ev.Name)
+			// 只需把 mtime 置零，下次 Match 会强制重新解析
+			ForceReload()
 		case err := <-w.Errors:
 			logx.D("[watch] %v", err)
 		}
 	}
 }
+
+func isRuleFile(name string) bool {
+	name = filepath.Clean(name)
+	for _, p := range append(candidates, File()) {
+		if filepath.Clean(p) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+//go:build !darwin
+
+package sysproxy
+
+import "fmt"
+
+// Enable 非 macOS 平台暂不支持自动设置系统代理
+func Enable(host string, port int) error {
+	return fmt.Errorf("sysproxy: unsupported on this platform, set proxy %s:%d manually", host, port)
+}
+
+// Disable 非 macOS 平台无操作
+func Disable() {}
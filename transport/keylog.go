@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"io"
+	"os"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+)
+
+/* ---------- SSLKEYLOGFILE：NSS key log，供 Wireshark 解密 ---------- */
+
+var keyLog io.Writer
+
+// SetKeyLog 以追加方式打开 key log 文件；需在 Configure 之前调用，之后创建的 TLS 配置都会写入
+func SetKeyLog(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	keyLog = f
+	logx.I("[tls    ] writing TLS session keys to %s (anyone with this file can decrypt the traffic)", path)
+	return nil
+}
+
+// KeyLog 返回 key log writer，未开启时为 nil
+func KeyLog() io.Writer { return keyLog }
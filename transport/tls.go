@@ -0,0 +1,290 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+/* ---------- 上游 TLS：全局校验模式 + tls:// 规则 ---------- */
+
+var global struct {
+	verify bool
+	roots  *x509.CertPool // nil = 系统根证书
+}
+
+// Configure 设置全局上游校验：mode 为 insecure（默认）或 verify；caFile 追加到系统根证书
+func Configure(mode, caFile string) error {
+	switch mode {
+	case "", "insecure":
+	case "verify":
+		global.verify = true
+	default:
+		return fmt.Errorf("upstream tls mode %q (want insecure or verify)", mode)
+	}
+	if caFile != "" {
+		pool, err := loadRoots(caFile)
+		if err != nil {
+			return err
+		}
+		global.roots = pool
+	}
+	setGlobal(newTransports(clientConfig(rules.TLSOptions{}, nil, global.roots))) // 启动时调用，尚无并发
+	return nil
+}
+
+// TLSConfig 返回直连上游时使用的配置（全局设置），供 -mirror-certs 探测上游
+func TLSConfig(serverName string) *tls.Config {
+	c := Upstream.TLSClientConfig.Clone()
+	c.ServerName = serverName
+	c.NextProtos = nil
+	return c
+}
+
+// For 返回规则对应的上游 RoundTripper：无 tls:// 时为全局连接池；r 为下游请求（mirror 模式按其协议选择）
+func For(ru *rules.Rule, r *http.Request) http.RoundTripper {
+	ps := ru.Params(rules.ActTLS)
+	if len(ps) == 0 {
+		return upstream.pick(r)
+	}
+	t, err := ruleTransports(strings.Join(ps, ","), ps)
+	if err != nil {
+		logx.I("[tls    ] %s: %v", ru.Pos(), err)
+		return failing{fmt.Errorf("tls:// in %s: %v", ru.Pos(), err)} // 不缓存，修好文件即可恢复
+	}
+	return t.pick(r)
+}
+
+type ruleEntry struct {
+	stamp string // 引用文件的 mtime / size
+	t     *transports
+}
+
+var perRule sync.Map // 拼接后的 tls:// 参数 → ruleEntry
+
+// ruleTransports 按参数缓存连接池；证书 / bundle 文件被替换（轮换）后重新加载
+func ruleTransports(key string, ps []string) (*transports, error) {
+	o, err := rules.ParseTLS(ps...)
+	if err != nil {
+		return nil, err
+	}
+	stamp, err := fileStamp(o.CAFile, o.CertFile, o.KeyFile, o.P12File)
+	if err != nil {
+		return nil, err
+	}
+	old, ok := perRule.Load(key)
+	if ok && old.(ruleEntry).stamp == stamp {
+		return old.(ruleEntry).t, nil
+	}
+	t, err := newRuleTransports(o)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		actual, _ := perRule.LoadOrStore(key, ruleEntry{stamp, t})
+		return actual.(ruleEntry).t, nil
+	}
+	if !perRule.CompareAndSwap(key, old, ruleEntry{stamp, t}) {
+		cur, _ := perRule.Load(key) // 并发重建时用先存下的那份，这份尚未建连接，直接丢弃
+		return cur.(ruleEntry).t, nil
+	}
+	old.(ruleEntry).t.closeIdle()
+	logx.D("[tls    ] %s changed, reloaded", key)
+	return t, nil
+}
+
+func fileStamp(files ...string) (string, error) {
+	var b strings.Builder
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", f, fi.ModTime().UnixNano(), fi.Size())
+	}
+	return b.String(), nil
+}
+
+func newRuleTransports(o rules.TLSOptions) (*transports, error) {
+	var err error
+	roots := global.roots
+	if o.CAFile != "" {
+		if roots, err = loadRoots(o.CAFile); err != nil {
+			return nil, err
+		}
+	}
+	var certs []tls.Certificate
+	if o.CertFile != "" || o.P12File != "" {
+		c, err := loadClientCert(o)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+	return newTransports(clientConfig(o, certs, roots)), nil
+}
+
+func clientConfig(o rules.TLSOptions, certs []tls.Certificate, roots *x509.CertPool) *tls.Config {
+	verify := global.verify
+	switch o.Mode {
+	case "verify":
+		verify = true
+	case "insecure":
+		verify = false
+	}
+	c := &tls.Config{
+		InsecureSkipVerify: !verify,
+		RootCAs:            roots,
+		Certificates:       certs,
+	}
+	if len(o.Pins) > 0 {
+		pins := o.Pins
+		c.VerifyConnection = func(cs tls.ConnectionState) error { return checkPins(cs, pins, verify) }
+	}
+	return c
+}
+
+func loadRoots(p string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", p)
+	}
+	return pool, nil
+}
+
+func loadClientCert(o rules.TLSOptions) (tls.Certificate, error) {
+	if o.P12File != "" {
+		data, err := os.ReadFile(o.P12File)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		pass := o.P12Pass
+		if strings.HasPrefix(pass, "$") {
+			pass = os.Getenv(pass[1:])
+		}
+		key, leaf, chain, err := pkcs12.DecodeChain(data, pass)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("%s: %v", o.P12File, err)
+		}
+		c := tls.Certificate{PrivateKey: key, Leaf: leaf, Certificate: [][]byte{leaf.Raw}}
+		for _, ca := range chain {
+			c.Certificate = append(c.Certificate, ca.Raw)
+		}
+		return c, nil
+	}
+	key := o.KeyFile
+	if key == "" { // 证书与私钥在同一个 PEM 中
+		key = o.CertFile
+	}
+	c, err := tls.LoadX509KeyPair(o.CertFile, key)
+	if err != nil {
+		return c, fmt.Errorf("client cert: %v", err)
+	}
+	return c, nil
+}
+
+/* ---------- pinning ---------- */
+
+// PinError 表示证书链中没有任何公钥与 pin 匹配
+type PinError struct {
+	Got []string
+}
+
+func (e *PinError) Error() string {
+	return fmt.Sprintf("no certificate in the upstream chain matches the pinned keys (chain: sha256/%s)", strings.Join(e.Got, ", sha256/"))
+}
+
+// checkPins 校验 SPKI pin。服务器发来的链未经校验，任何人都能在后面附上真实的中间证书，
+// 因此 verified 时只认校验通过的链（leaf / 中间 / 根均可）；insecure 时只认 leaf
+func checkPins(cs tls.ConnectionState, pins []string, verified bool) error {
+	var certs []*x509.Certificate
+	switch {
+	case verified:
+		for _, chain := range cs.VerifiedChains {
+			certs = append(certs, chain...)
+		}
+	case len(cs.PeerCertificates) > 0:
+		certs = cs.PeerCertificates[:1]
+	}
+	var got []string
+	for _, c := range certs {
+		sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+		h := base64.StdEncoding.EncodeToString(sum[:])
+		if slices.Contains(pins, h) {
+			return nil
+		}
+		if !slices.Contains(got, h) {
+			got = append(got, h)
+		}
+	}
+	return &PinError{Got: got}
+}
+
+/* ---------- 错误页 ---------- */
+
+type failing struct{ err error }
+
+func (f failing) RoundTrip(*http.Request) (*http.Response, error) { return nil, f.err }
+
+// IsVerifyError 判断是否为上游证书校验失败
+func IsVerifyError(err error) bool {
+	var (
+		cv  *tls.CertificateVerificationError
+		pin *PinError
+		ua  x509.UnknownAuthorityError
+		hn  x509.HostnameError
+		ci  x509.CertificateInvalidError
+	)
+	return errors.As(err, &cv) || errors.As(err, &pin) || errors.As(err, &ua) || errors.As(err, &hn) || errors.As(err, &ci)
+}
+
+// ErrorResponse 把上游错误转成 502；证书校验失败时给出说明页
+func ErrorResponse(req *http.Request, err error) *http.Response {
+	body, ct := err.Error(), "text/plain; charset=utf-8"
+	if IsVerifyError(err) {
+		ct = "text/html; charset=utf-8"
+		body = fmt.Sprintf(`<!doctype html><title>Upstream certificate rejected</title>
+<h1>Upstream certificate rejected</h1>
+<p>gw-lite refused to talk to <b>%s</b> because its TLS certificate did not pass verification:</p>
+<pre>%s</pre>
+<p>Fix the upstream certificate, pass a CA bundle (<code>-upstream-ca</code> or <code>tls://ca=@bundle.pem</code>),
+or opt out for this host with <code>tls://insecure</code>.</p>
+`, html.EscapeString(req.URL.Host), html.EscapeString(err.Error()))
+	}
+	return &http.Response{
+		Status:        "502 Bad Gateway",
+		StatusCode:    http.StatusBadGateway,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {ct}},
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(strings.NewReader(body)),
+		Request:       req,
+	}
+}
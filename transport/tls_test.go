@@ -0,0 +1,195 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sonacy/go-whistle-lite/rules"
+)
+
+func testCert(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := x509.ParseCertificate(der)
+	return c
+}
+
+func writePEM(t *testing.T, p string, c *x509.Certificate, mod time.Time) {
+	t.Helper()
+	if err := os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRuleTransportsReload(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "bundle.pem")
+	ps := []string{"verify,ca=@" + bundle}
+	key := "reload:" + bundle
+	base := time.Now().Add(-time.Minute)
+
+	writePEM(t, bundle, testCert(t, "one"), base)
+	t1, err := ruleTransports(key, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if t2, _ := ruleTransports(key, ps); t2 != t1 {
+		t.Error("unchanged bundle was reloaded")
+	}
+
+	writePEM(t, bundle, testCert(t, "two"), base.Add(time.Second)) // 轮换
+	t3, err := ruleTransports(key, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if t3 == t1 {
+		t.Error("rotated bundle was not reloaded")
+	}
+
+	os.Remove(bundle)
+	if _, err := ruleTransports(key, ps); err == nil {
+		t.Error("missing bundle: expected an error")
+	}
+	writePEM(t, bundle, testCert(t, "three"), base.Add(2*time.Second))
+	if t4, err := ruleTransports(key, ps); err != nil || t4 == t3 {
+		t.Errorf("restored bundle: %v, reloaded %v", err, t4 != t3)
+	}
+}
+
+// issue 签发证书；parent 为 nil 时自签名
+func issue(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	if !isCA {
+		tpl.DNSNames = []string{cn}
+		tpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	if parent == nil {
+		parent, parentKey = tpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := x509.ParseCertificate(der)
+	return c, key
+}
+
+func pin(c *x509.Certificate) string {
+	sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// handshake 让服务器出示 chain，用 tls:// 选项对应的客户端配置握手
+func handshake(t *testing.T, o rules.TLSOptions, roots *x509.CertPool, key *ecdsa.PrivateKey, chain ...*x509.Certificate) error {
+	t.Helper()
+	srv := tls.Certificate{PrivateKey: key}
+	for _, c := range chain {
+		srv.Certificate = append(srv.Certificate, c.Raw)
+	}
+	// net.Pipe 无缓冲，客户端中途拒绝时双方会互相卡住，这里用真实连接
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		tls.Server(c, &tls.Config{Certificates: []tls.Certificate{srv}}).Handshake()
+	}()
+	conn, err := net.DialTimeout("tcp", ln.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	cfg := clientConfig(o, nil, roots)
+	cfg.ServerName = "a.test"
+	return tls.Client(conn, cfg).Handshake()
+}
+
+func TestPinning(t *testing.T) {
+	ca, caKey := issue(t, "real ca", true, nil, nil)
+	leaf, leafKey := issue(t, "a.test", false, ca, caKey)
+	fake, fakeKey := issue(t, "a.test", false, nil, nil) // 攻击者自签的 leaf
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	cases := []struct {
+		name  string
+		o     rules.TLSOptions
+		key   *ecdsa.PrivateKey
+		chain []*x509.Certificate
+		ok    bool
+	}{
+		{"verify, pin on CA", rules.TLSOptions{Mode: "verify", Pins: []string{pin(ca)}}, leafKey, []*x509.Certificate{leaf}, true},
+		{"verify, pin on leaf", rules.TLSOptions{Mode: "verify", Pins: []string{pin(leaf)}}, leafKey, []*x509.Certificate{leaf, ca}, true},
+		{"verify, pin elsewhere", rules.TLSOptions{Mode: "verify", Pins: []string{pin(fake)}}, leafKey, []*x509.Certificate{leaf}, false},
+		{"verify, forged chain", rules.TLSOptions{Mode: "verify", Pins: []string{pin(ca)}}, fakeKey, []*x509.Certificate{fake, ca}, false},
+		{"insecure, pin on leaf", rules.TLSOptions{Mode: "insecure", Pins: []string{pin(fake)}}, fakeKey, []*x509.Certificate{fake}, true},
+		// 自签 leaf 后面附上真实的 CA：链上有 pin 命中，但 leaf 不是它
+		{"insecure, forged chain", rules.TLSOptions{Mode: "insecure", Pins: []string{pin(ca)}}, fakeKey, []*x509.Certificate{fake, ca}, false},
+		{"insecure, real chain pinned on CA", rules.TLSOptions{Mode: "insecure", Pins: []string{pin(ca)}}, leafKey, []*x509.Certificate{leaf, ca}, false},
+	}
+	for _, c := range cases {
+		err := handshake(t, c.o, roots, c.key, c.chain...)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: handshake error %v, want ok=%v", c.name, err, c.ok)
+		}
+		if err != nil && !IsVerifyError(err) {
+			t.Errorf("%s: %v is not reported as a verification error", c.name, err)
+		}
+	}
+
+	var pe *PinError
+	err := checkPins(tls.ConnectionState{PeerCertificates: []*x509.Certificate{fake, ca}}, []string{pin(ca)}, false)
+	if !errors.As(err, &pe) || len(pe.Got) != 1 || pe.Got[0] != pin(fake) {
+		t.Errorf("insecure mismatch = %v, want only the leaf reported", err)
+	}
+}
@@ -1,22 +1,174 @@
 package transport
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	http2 "golang.org/x/net/http2"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
 )
 
+// Upstream 是全局 TLS 配置下的 auto 传输（ALPN 协商，优先 h2）
 var Upstream *http.Transport
 
+var upstream *transports // 全局 TLS 配置下三种协议的连接池
+
 func init() {
-	Upstream = &http.Transport{
+	setGlobal(newTransports(&tls.Config{InsecureSkipVerify: true})) // 默认不校验，见 Configure
+}
+
+func setGlobal(t *transports) {
+	upstream, Upstream = t, t.auto
+}
+
+/* ---------- 上游协议：auto（ALPN 协商）/ h1 / h2 / mirror（跟随下游） ---------- */
+
+var upstreamProto = "auto"
+
+// SetProto 设置上游协议，启动时调用
+func SetProto(p string) error {
+	switch p {
+	case "":
+		p = "auto"
+	case "auto", "h1", "h2", "mirror":
+	default:
+		return fmt.Errorf("upstream proto %q (want auto, h1, h2 or mirror)", p)
+	}
+	upstreamProto = p
+	return nil
+}
+
+// transports 同一 TLS 配置下各协议独立的连接池
+type transports struct {
+	auto *http.Transport
+	h1   *http.Transport
+	h2   http.RoundTripper
+}
+
+func newTransports(tc *tls.Config) *transports {
+	h1 := newH1Transport(tc.Clone())
+	return &transports{
+		auto: newTransport(tc),
+		h1:   h1,
+		h2:   h2Only{h2: &http2.Transport{TLSClientConfig: tc.Clone()}, h1: h1},
+	}
+}
+
+// closeIdle 关闭空闲连接（连接池被替换后调用，进行中的请求不受影响）
+func (t *transports) closeIdle() {
+	t.auto.CloseIdleConnections()
+	t.h1.CloseIdleConnections()
+	if h, ok := t.h2.(h2Only); ok {
+		h.h2.CloseIdleConnections()
+	}
+}
+
+// pick 按上游协议设置选择连接池；mirror 时 H1 客户端走 h1，H2 客户端走 auto（上游不支持 h2 时回落）。
+// h2c 客户端（明文 HTTP/2）访问 http:// 上游时除 h1 外都走 h2c prior-knowledge，gRPC 才能透传
+func (t *transports) pick(r *http.Request) http.RoundTripper {
+	if upstreamProto != "h1" && r != nil && r.ProtoMajor == 2 && r.TLS == nil {
+		return withH2C{t.pickProto(r)}
+	}
+	return t.pickProto(r)
+}
+
+func (t *transports) pickProto(r *http.Request) http.RoundTripper {
+	p := upstreamProto
+	if p == "mirror" {
+		if r != nil && r.ProtoMajor == 2 {
+			p = "auto"
+		} else {
+			p = "h1"
+		}
+	}
+	switch p {
+	case "h1":
+		return t.h1
+	case "h2":
+		return t.h2
+	}
+	return t.auto
+}
+
+func newTransport(tc *tls.Config) *http.Transport {
+	t := baseTransport(tc)
+	_ = http2.ConfigureTransport(t) // enable h2 pooling
+	return t
+}
+
+// newH1Transport 只说 HTTP/1.1：非 nil 的空 TLSNextProto 会关闭 h2
+func newH1Transport(tc *tls.Config) *http.Transport {
+	t := baseTransport(tc)
+	t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	return t
+}
+
+func baseTransport(tc *tls.Config) *http.Transport {
+	tc.KeyLogWriter = keyLog
+	return &http.Transport{
 		Proxy:               http.ProxyFromEnvironment,
 		MaxIdleConns:        2000,
 		MaxIdleConnsPerHost: 200,
 		IdleConnTimeout:     90 * time.Second,
-		TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+		TLSClientConfig:     tc,
+	}
+}
+
+// h2Only 对 https 强制 h2（上游不支持时报错）；http:// 目标没有 ALPN，仍走 h1。
+// 注意 http2.Transport 不读取 HTTPS_PROXY
+type h2Only struct {
+	h2 *http2.Transport
+	h1 http.RoundTripper
+}
+
+func (t h2Only) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Scheme == "https" {
+		return t.h2.RoundTrip(r)
+	}
+	return t.h1.RoundTrip(r)
+}
+
+// h2c 以 prior-knowledge 明文 HTTP/2 连接上游，与 TLS 配置无关，全局共用一个连接池
+var h2c = &http2.Transport{
+	AllowHTTP: true,
+	DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		return (&net.Dialer{Timeout: 10 * time.Second}).DialContext(ctx, network, addr)
+	},
+}
+
+// 连上了但不说 h2c 的上游（普通 HTTP/1 服务），记下后直接走 rt
+var noH2C sync.Map // host:port → struct{}
+
+type withH2C struct{ rt http.RoundTripper }
+
+func (t withH2C) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Scheme != "http" {
+		return t.rt.RoundTrip(r)
+	}
+	if _, ok := noH2C.Load(r.URL.Host); ok {
+		return t.rt.RoundTrip(r)
+	}
+	resp, err := h2c.RoundTrip(r)
+	var op *net.OpError
+	if err == nil || errors.As(err, &op) && op.Op == "dial" {
+		return resp, err
+	}
+	logx.D("[h2c    ] %s: %v (falling back to HTTP/1.1)", r.URL.Host, err)
+	noH2C.Store(r.URL.Host, struct{}{})
+	if r.Body != nil && r.Body != http.NoBody { // 请求体可能已被读走，只有 GetBody 时才重放
+		if r.GetBody == nil {
+			return nil, err
+		}
+		if r.Body, err = r.GetBody(); err != nil {
+			return nil, err
+		}
 	}
-	_ = http2.ConfigureTransport(Upstream) // enable h2 pooling
+	return t.rt.RoundTrip(r)
 }
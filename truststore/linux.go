@@ -0,0 +1,199 @@
+//go:build linux
+
+package truststore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sonacy/go-whistle-lite/internal/logx"
+)
+
+// 系统信任库：目录存在即视为该发行版的布局
+var systemStores = []struct {
+	dir, file      string
+	update, remove []string // 安装 / 卸载后运行的更新命令
+}{
+	// Debian / Ubuntu / Alpine：卸载需要 --fresh 才会清掉 /etc/ssl/certs 里的悬空链接
+	{"usr/local/share/ca-certificates", FileName + ".crt", []string{"update-ca-certificates"}, []string{"update-ca-certificates", "--fresh"}},
+	// Fedora / RHEL
+	{"etc/pki/ca-trust/source/anchors", FileName + ".pem", []string{"update-ca-trust", "extract"}, []string{"update-ca-trust", "extract"}},
+}
+
+// Install 把 PEM 证书写入系统信任库并可选写入 NSS 数据库，返回已执行的步骤
+func Install(pemCert []byte, nick string, o Options) ([]string, error) {
+	o.defaults()
+	var done []string
+	if o.System {
+		steps, err := o.system(func(path string) error { return os.WriteFile(path, pemCert, 0644) }, false)
+		done = append(done, steps...)
+		if err != nil {
+			return done, err
+		}
+	}
+	if o.NSS {
+		tmp, err := os.CreateTemp("", "gw-ca-*.pem")
+		if err != nil {
+			return done, err
+		}
+		defer os.Remove(tmp.Name())
+		tmp.Write(pemCert)
+		tmp.Close()
+		steps, err := o.nss("installed", "-A", "-n", nick, "-t", "C,,", "-i", tmp.Name())
+		done = append(done, steps...)
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+// Uninstall 从系统信任库与 NSS 数据库中移除证书
+func Uninstall(nick string, o Options) ([]string, error) {
+	o.defaults()
+	var done []string
+	if o.System {
+		steps, err := o.system(func(path string) error {
+			if err := os.Remove(path); !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			return errSkip
+		}, true)
+		done = append(done, steps...)
+		if err != nil {
+			return done, err
+		}
+	}
+	if o.NSS {
+		steps, err := o.nss("removed", "-D", "-n", nick)
+		done = append(done, steps...)
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+var errSkip = errors.New("skip")
+
+func (o *Options) defaults() {
+	if o.Root == "" {
+		o.Root = "/"
+	}
+	if o.Home == "" {
+		o.Home = filepath.Join(o.Root, InvokingHome())
+	}
+}
+
+// system 对每个存在的信任库目录执行 fn，随后运行对应的更新工具
+func (o Options) system(fn func(path string) error, remove bool) ([]string, error) {
+	verb := "installed"
+	if remove {
+		verb = "removed"
+	}
+	var done []string
+	found := false
+	for _, s := range systemStores {
+		dir := filepath.Join(o.Root, s.dir)
+		if !isDir(dir) {
+			continue
+		}
+		found = true
+		path := filepath.Join(dir, s.file)
+		switch err := fn(path); {
+		case errors.Is(err, errSkip):
+			done = append(done, "not present: "+path)
+			continue
+		case errors.Is(err, os.ErrPermission):
+			return done, fmt.Errorf("%s: permission denied (run with sudo)", path)
+		case err != nil:
+			return done, err
+		}
+		done = append(done, verb+" "+path)
+
+		update := s.update
+		if remove {
+			update = s.remove
+		}
+		if o.Root != "/" { // 测试用的临时根目录：不要动真实系统
+			done = append(done, "skipped "+update[0]+" (-root is set)")
+			continue
+		}
+		logx.D("[truststore] run %v", update)
+		if out, err := exec.Command(update[0], update[1:]...).CombinedOutput(); err != nil {
+			return done, fmt.Errorf("%s: %v: %s", update[0], err, out)
+		}
+		done = append(done, "ran "+strings.Join(update, " "))
+	}
+	if !found {
+		return nil, fmt.Errorf("no supported trust store under %s (looked for /%s and /%s)",
+			o.Root, systemStores[0].dir, systemStores[1].dir)
+	}
+	return done, nil
+}
+
+// nss 对找到的每个 NSS 数据库运行 certutil
+func (o Options) nss(verb string, args ...string) ([]string, error) {
+	dbs := o.nssDBs()
+	if len(dbs) == 0 {
+		return []string{"no NSS databases found"}, nil
+	}
+	certutil, err := exec.LookPath("certutil")
+	if err != nil {
+		return nil, fmt.Errorf("certutil not found (install libnss3-tools or nss-tools) for %d NSS database(s)", len(dbs))
+	}
+	var done []string
+	for _, db := range dbs {
+		cmd := append([]string{"-d", db}, args...)
+		logx.D("[truststore] certutil %v", cmd)
+		if out, err := exec.Command(certutil, cmd...).CombinedOutput(); err != nil {
+			if verb == "removed" && certNotFound(out) { // 数据库中本来就没有
+				done = append(done, "not in "+db)
+				continue
+			}
+			return done, fmt.Errorf("certutil %s: %v: %s", db, err, out)
+		}
+		done = append(done, verb+" "+db)
+	}
+	return done, nil
+}
+
+// certNotFound 识别 certutil -D 删除不存在的证书时的报错；其余失败（数据库损坏、权限等）照常返回
+func certNotFound(out []byte) bool {
+	return strings.Contains(string(out), "could not find cert") || strings.Contains(string(out), "SEC_ERROR_UNRECOGNIZED_OID")
+}
+
+// nssDBs: ~/.pki/nssdb 与 Firefox（含 snap 版）profile
+func (o Options) nssDBs() []string {
+	var dbs []string
+	add := func(dir string) {
+		switch {
+		case isFile(filepath.Join(dir, "cert9.db")):
+			dbs = append(dbs, "sql:"+dir)
+		case isFile(filepath.Join(dir, "cert8.db")):
+			dbs = append(dbs, "dbm:"+dir)
+		}
+	}
+	add(filepath.Join(o.Home, ".pki", "nssdb"))
+	for _, base := range []string{".mozilla/firefox", "snap/firefox/common/.mozilla/firefox"} {
+		profiles, _ := filepath.Glob(filepath.Join(o.Home, base, "*"))
+		for _, p := range profiles {
+			add(p)
+		}
+	}
+	return dbs
+}
+
+func isDir(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && fi.IsDir()
+}
+
+func isFile(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && fi.Mode().IsRegular()
+}
@@ -0,0 +1,125 @@
+//go:build linux
+
+package truststore
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testPEM = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+
+func TestInstallUninstallUnderRoot(t *testing.T) {
+	for _, store := range systemStores {
+		t.Run(store.dir, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, store.dir)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			o := Options{Root: root, Home: filepath.Join(root, "home"), System: true}
+			path := filepath.Join(dir, store.file)
+
+			steps, err := Install([]byte(testPEM), "test CA", o)
+			if err != nil {
+				t.Fatalf("install: %v", err)
+			}
+			if b, err := os.ReadFile(path); err != nil || string(b) != testPEM {
+				t.Fatalf("installed file = %q, %v", b, err)
+			}
+			want := []string{"installed " + path, "skipped " + store.update[0] + " (-root is set)"}
+			if !slices.Equal(steps, want) {
+				t.Errorf("install steps = %q, want %q", steps, want)
+			}
+
+			if _, err := Uninstall("test CA", o); err != nil {
+				t.Fatalf("uninstall: %v", err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("file still present after uninstall: %v", err)
+			}
+			steps, err = Uninstall("test CA", o)
+			if err != nil || len(steps) != 1 || steps[0] != "not present: "+path {
+				t.Errorf("second uninstall = %q, %v", steps, err)
+			}
+		})
+	}
+}
+
+func TestInstallWithoutStore(t *testing.T) {
+	_, err := Install([]byte(testPEM), "test CA", Options{Root: t.TempDir(), System: true})
+	if err == nil || !strings.Contains(err.Error(), "no supported trust store") {
+		t.Errorf("err = %v, want no supported trust store", err)
+	}
+}
+
+func TestNSSDatabases(t *testing.T) {
+	home := t.TempDir()
+	for _, f := range []string{
+		".pki/nssdb/cert9.db",
+		".mozilla/firefox/abc.default/cert9.db",
+		".mozilla/firefox/old.default/cert8.db",
+		"snap/firefox/common/.mozilla/firefox/x.snap/cert9.db",
+		".mozilla/firefox/empty.default/prefs.js",
+	} {
+		p := filepath.Join(home, f)
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		os.WriteFile(p, nil, 0o644)
+	}
+	got := Options{Home: home}.nssDBs()
+	want := []string{
+		"sql:" + filepath.Join(home, ".pki/nssdb"),
+		"sql:" + filepath.Join(home, ".mozilla/firefox/abc.default"),
+		"dbm:" + filepath.Join(home, ".mozilla/firefox/old.default"),
+		"sql:" + filepath.Join(home, "snap/firefox/common/.mozilla/firefox/x.snap"),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("nssDBs =\n%q\nwant\n%q", got, want)
+	}
+
+	steps, err := Install([]byte(testPEM), "test CA", Options{Root: t.TempDir(), Home: t.TempDir(), NSS: true})
+	if err != nil || !slices.Equal(steps, []string{"no NSS databases found"}) {
+		t.Errorf("install into empty home = %q, %v", steps, err)
+	}
+}
+
+func TestDefaultHomeUnderRoot(t *testing.T) {
+	t.Setenv("SUDO_USER", "")
+	t.Setenv("HOME", "/home/alice")
+	o := Options{Root: "/tmp/scratch"}
+	o.defaults()
+	if o.Home != "/tmp/scratch/home/alice" {
+		t.Errorf("Home = %q", o.Home)
+	}
+}
+
+// TestNSSUninstallErrors 只有 "找不到证书" 才算已卸载，其余 certutil 失败要报出来
+func TestNSSUninstallErrors(t *testing.T) {
+	home := t.TempDir()
+	os.MkdirAll(filepath.Join(home, ".pki/nssdb"), 0o755)
+	os.WriteFile(filepath.Join(home, ".pki/nssdb/cert9.db"), nil, 0o644)
+	bin := t.TempDir()
+	t.Setenv("PATH", bin)
+	o := Options{Root: t.TempDir(), Home: home, NSS: true}
+
+	fake := func(out string) {
+		script := "#!/bin/sh\necho '" + out + "' >&2\nexit 255\n"
+		if err := os.WriteFile(filepath.Join(bin, "certutil"), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake(`certutil: could not find certificate named "test CA": SEC_ERROR_UNRECOGNIZED_OID: Unrecognized Object Identifier.`)
+	steps, err := Uninstall("test CA", o)
+	if err != nil || len(steps) != 1 || !strings.HasPrefix(steps[0], "not in ") {
+		t.Errorf("missing cert: %q, %v", steps, err)
+	}
+
+	fake(`certutil: function failed: SEC_ERROR_READ_ONLY: security library: read-only database.`)
+	if _, err := Uninstall("test CA", o); err == nil || !strings.Contains(err.Error(), "SEC_ERROR_READ_ONLY") {
+		t.Errorf("read-only database: err = %v", err)
+	}
+}
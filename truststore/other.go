@@ -0,0 +1,15 @@
+//go:build !linux
+
+package truststore
+
+import "fmt"
+
+// Install 非 Linux 平台暂不支持，请手动导入根证书
+func Install(pemCert []byte, nick string, o Options) ([]string, error) {
+	return nil, fmt.Errorf("truststore: unsupported on this platform, import the root CA manually")
+}
+
+// Uninstall 非 Linux 平台暂不支持
+func Uninstall(nick string, o Options) ([]string, error) {
+	return nil, fmt.Errorf("truststore: unsupported on this platform, remove the root CA manually")
+}
@@ -0,0 +1,28 @@
+// Package truststore 把 MITM 根证书装入 / 移出操作系统与 NSS 的信任库
+package truststore
+
+import (
+	"os"
+	"os/user"
+)
+
+// FileName 是写入系统信任库的文件名（不含扩展名）
+const FileName = "go-whistle-lite"
+
+// Options 控制安装位置；Root / Home 可指向临时目录以便测试
+type Options struct {
+	Root   string // 文件系统根，默认 "/"；非 "/" 时不会运行系统更新工具
+	Home   string // NSS 数据库所在的 home，默认 Root 下的 InvokingHome()
+	System bool   // 系统信任库
+	NSS    bool   // ~/.pki/nssdb 与 Firefox profile
+}
+
+// InvokingHome 返回实际用户的 home：sudo 下取 SUDO_USER 的，而不是 /root
+func InvokingHome() string {
+	if name := os.Getenv("SUDO_USER"); name != "" && os.Geteuid() == 0 {
+		if u, err := user.Lookup(name); err == nil && u.HomeDir != "" {
+			return u.HomeDir
+		}
+	}
+	return os.Getenv("HOME")
+}